@@ -0,0 +1,227 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Batched iteration by primary key
+
+package shorm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Parallel makes FindInBatches process all groups concurrently, fn is called concurrently then
+func (s *Session) Parallel() *Session {
+	s.parallel = true
+	return s
+}
+
+// FindInBatches walks records matched by conditions in batches of batchSize,
+// fn is called with pointer to slice of each batch, the slice of slicePtr is reused in sequence mode,
+// and new slices of the same type are used by groups in parallel mode.
+// Records are paged by primary key(where pk>last order by pk) on each group instead of offset,
+// so the model must have 'pk' column, and table scan is allowed by design.
+// Or conditions are not supported as they break paging, use Or in WhereCond instead, neither is raw query.
+// Without shard value, groups are walked one by one, or concurrently if Parallel is specified.
+// Iteration stops once fn returns error, which is returned by FindInBatches.
+/*
+	Usage:
+		var orders []*Order
+		err := session.Where("Status=?", 1).FindInBatches(&orders, 500, func(batch interface{}) error {
+			for _, order := range *batch.(*[]*Order) {
+				...
+			}
+			return nil
+		})
+*/
+func (s *Session) FindInBatches(slicePtr interface{}, batchSize int, fn func(batch interface{}) error) error {
+	defer s.reset()
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.checkRowLock(); err != nil {
+		return err
+	}
+	if batchSize <= 0 {
+		return fmt.Errorf("batch size must be greater than 0, but %d", batchSize)
+	}
+	table, err := s.getSliceTable(slicePtr)
+	if err != nil {
+		return err
+	}
+	if table.IdColumn == nil {
+		return fmt.Errorf("table %s has no pk column for batches", table.Name)
+	}
+	if s.clauseList.has(opType_rawQuery) {
+		return fmt.Errorf("raw query is not supported by batches, it can not be paged by pk")
+	}
+	for _, c := range s.clauseList {
+		if c.op == opType_or || c.op == opType_in_or || c.op == opType_between_or {
+			return fmt.Errorf("or condition is not supported by batches, use Or in WhereCond instead")
+		}
+	}
+	base := s.clauseList.without(opType_orderby, opType_limit, opType_top)
+	var groups []*DbGroup
+	if s.hasShardKey || s.cluster.has1DbGroup() {
+		if !s.hasShardKey {
+			if err = s.useDefaultGroup(); err != nil {
+				return err
+			}
+		}
+		groups = []*DbGroup{s.group}
+	} else {
+		if err = s.checkJoin(table); err != nil {
+			return err
+		}
+		groups = s.cluster.Groups
+	}
+	walker := &batchWalker{s: s, table: table, base: base, batchSize: batchSize, fn: fn}
+	if !s.parallel {
+		slice := reflect.ValueOf(slicePtr)
+		for _, group := range groups {
+			if err = walker.walk(group, slice); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	wg := &sync.WaitGroup{}
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group *DbGroup) {
+			defer wg.Done()
+			walker.stop(walker.walk(group, reflect.New(reflect.TypeOf(slicePtr).Elem())))
+		}(group)
+	}
+	wg.Wait()
+	return walker.err
+}
+
+//Walks batches of groups
+type batchWalker struct {
+	s         *Session
+	table     *TableMetadata
+	base      sqlClauseList //clauses of conditions
+	batchSize int
+	fn        func(batch interface{}) error
+	lock      sync.Mutex
+	err       error //the first error stopping all groups
+}
+
+func (w *batchWalker) stop(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *batchWalker) stopped() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err != nil
+}
+
+//Walks batches of group, slice is pointer to slice of batch
+func (w *batchWalker) walk(group *DbGroup, slice reflect.Value) error {
+	node, err := w.s.readNode(group)
+	if err != nil {
+		return err
+	}
+	idCol := w.table.IdColumn
+	var last interface{}
+	for !w.stopped() {
+		sqlStr, args := w.genBatch(last)
+		w.s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
+		slice.Elem().SetLen(0)
+		if err = w.find(node, sqlStr, args, slice.Interface()); err != nil {
+			return &ShardError{Group: group.Name, Node: node.Name, Err: err}
+		}
+		n := slice.Elem().Len()
+		if n <= 0 {
+			return nil
+		}
+		if err = w.fn(slice.Interface()); err != nil {
+			return err
+		}
+		if n < w.batchSize {
+			return nil
+		}
+		last = maxIdValue(slice.Elem(), idCol)
+	}
+	return nil
+}
+
+//Generates sql of batch after last pk, nil last for the first batch.
+//Conditions of caller are parenthesized in every batch, so or in raw clause can not bind to pk condition.
+func (w *batchWalker) genBatch(last interface{}) (string, []interface{}) {
+	idCol := w.table.IdColumn
+	sqls := append(sqlClauseList(nil), w.base...)
+	for i, c := range sqls {
+		if c.op != opType_where && c.op != opType_and {
+			continue
+		}
+		if c.cond != nil {
+			sqls[i].cond = parenCond{c.cond}
+		} else {
+			sqls[i].cond = exprCond{c.clause, c.params}
+		}
+	}
+	if last != nil {
+		sqls = append(sqls, sqlClause{op: opType_where, cond: Gt(idCol.name, last)})
+	}
+	sqls = append(sqls,
+		sqlClause{op: opType_orderby, clause: idCol.name},
+		sqlClause{op: opType_limit, params: []interface{}{0, w.batchSize}})
+	return w.s.sqlGen.GenSelect(w.table, sqls)
+}
+
+//Condition in parentheses
+type parenCond struct {
+	cond Cond
+}
+
+func (c parenCond) build(b *condBuilder) {
+	b.buf.WriteString("(")
+	c.cond.build(b)
+	b.buf.WriteString(")")
+}
+
+func (w *batchWalker) find(node *DbNode, sqlStr string, args []interface{}, slicePtr interface{}) error {
+	rows, err := queryRows(node.Db, sqlStr, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	valuePair, err := row2Slice(rows, w.table.Columns, false)
+	if err != nil {
+		return err
+	}
+	return toStructList(valuePair, slicePtr)
+}
+
+//Gets value of pk column of element
+func idValue(elem reflect.Value, idCol *columnMetadata) interface{} {
+	elem = reflect.Indirect(elem)
+	if len(idCol.parentFieldIndex) > 0 {
+		elem = reflect.Indirect(elem.FieldByIndex(idCol.parentFieldIndex))
+	}
+	return elem.FieldByIndex(idCol.fieldIndex).Interface()
+}
+
+//Gets the max pk of batch, rows are not in order of pk if paging sql has no outer order by, such as sql server
+func maxIdValue(slice reflect.Value, idCol *columnMetadata) interface{} {
+	var max interface{}
+	for i := 0; i < slice.Len(); i++ {
+		id := idValue(slice.Index(i), idCol)
+		if max == nil || compareValue(sortValue(id), sortValue(max)) > 0 {
+			max = id
+		}
+	}
+	return max
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenBatch(t *testing.T) {
+	table, err := getTableMeta(genUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := sqlClauseList(W().Where("Age>? or UserName=?", 18, "sz").And("Age<?", 60).WhereCond(Gt("Age", 6)).
+		OrderBy("Age").Limit(0, 10)).without(opType_orderby, opType_limit, opType_top)
+	w := &batchWalker{s: &Session{sqlGen: newBaseGenerator()}, table: table, base: base, batchSize: 100}
+	cases := []struct {
+		last interface{}
+		sql  string
+		args []interface{}
+	}{
+		{nil, "select `Age`,`UserId`,`UserName` from `T_User` where (Age>? or UserName=?) and (`Age`>?) and (Age<?) order by UserId limit 0,100",
+			[]interface{}{18, "sz", 6, 60}},
+		{int64(7), "select `Age`,`UserId`,`UserName` from `T_User` where (Age>? or UserName=?) and (`Age`>?) and `UserId`>? and (Age<?) order by UserId limit 0,100",
+			[]interface{}{18, "sz", 6, int64(7), 60}},
+	}
+	for _, c := range cases {
+		sql, args := w.genBatch(c.last)
+		if sql != c.sql {
+			t.Errorf("last %v:\n\texpected %s\n\tbut      %s", c.last, c.sql, sql)
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("last %v: expected args %v, but %v", c.last, c.args, args)
+		}
+	}
+	if id := idValue(reflect.ValueOf(&genUser{Id: 9}), table.IdColumn); id != int64(9) {
+		t.Errorf("expected pk 9, but %v", id)
+	}
+	batch := []*genUser{{Id: 3}, {Id: 9}, {Id: 5}}
+	if id := maxIdValue(reflect.ValueOf(batch), table.IdColumn); id != int64(9) {
+		t.Errorf("expected max pk 9 of batch not in order, but %v", id)
+	}
+}
+
+func TestFindInBatchesRawQuery(t *testing.T) {
+	engine, _ := newFakeEngine("mysql")
+	s := engine.StartSession()
+	defer engine.EndSession(s)
+	var users []*genUser
+	err := s.Query("select * from T_User").FindInBatches(&users, 10, func(interface{}) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "raw query") {
+		t.Errorf("expected error of raw query, but %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"sync"
 )
 
 //Sharding interface
@@ -19,13 +20,49 @@ type Shardinger interface {
 
 //Cluster that includes one or more db groups
 type Cluster struct {
-	TotalGroups   int        `json:"total_groups"`
-	RealGroups    int        `json:"-"`
-	Groups        []*DbGroup `json:"groups" xml:"Groups>Group"`
+	TotalGroups   int        `json:"total_groups" yaml:"total_groups" toml:"total_groups"`
+	RealGroups    int        `json:"-" yaml:"-" toml:"-"`
+	Groups        []*DbGroup `json:"groups" xml:"Groups>Group" yaml:"groups" toml:"groups"`
 	_defaultGroup *DbGroup
+	PoolSettings  `yaml:",inline"` //Default pool settings of all nodes
+
+	refLock  sync.Mutex
+	sessions int           //count of sessions working on the cluster
+	retired  bool          //cluster has been replaced by Engine.Reload
+	drained  chan struct{} //closed when cluster is retired and no session works on it
+}
+
+func (c *Cluster) acquire() {
+	c.refLock.Lock()
+	c.sessions++
+	c.refLock.Unlock()
+}
+
+func (c *Cluster) release() {
+	c.refLock.Lock()
+	defer c.refLock.Unlock()
+	c.sessions--
+	if c.retired && c.sessions <= 0 && c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
 }
 
-//Open all db nodes
+//Mark cluster as retired, returned channel will be closed after all sessions ended
+func (c *Cluster) retire() <-chan struct{} {
+	c.refLock.Lock()
+	defer c.refLock.Unlock()
+	drained := make(chan struct{})
+	c.retired = true
+	if c.sessions <= 0 {
+		close(drained)
+	} else {
+		c.drained = drained
+	}
+	return drained
+}
+
+//Open all db nodes, and apply pool settings
 func (c *Cluster) Open(driver string) (err error) {
 Loop:
 	for _, g := range c.Groups {
@@ -36,6 +73,7 @@ Loop:
 			}
 		}
 	}
+	c.applyPoolSettings()
 	return
 }
 
@@ -89,20 +127,22 @@ func (c *Cluster) DefaultGroup() (*DbGroup, error) {
 			return m, nil
 		}
 	}
-	return nil, fmt.Errorf("Not specified defaut db group")
+	return nil, ErrNoDefaultGroup
 }
 
 //DbGroup that includes one master and 0 or more salve nodes
 //provides support for high availability and high performance
 type DbGroup struct {
-	Name      string    `json:"name"`
-	RangeFrom int64     `json:"range_from"`
-	RangeTo   int64     `json:"range_to"`
-	Nodes     []*DbNode `json:"nodes" xml:"Nodes>Node"`
+	Name      string    `json:"name" yaml:"name" toml:"name"`
+	RangeFrom int64     `json:"range_from" yaml:"range_from" toml:"range_from"`
+	RangeTo   int64     `json:"range_to" yaml:"range_to" toml:"range_to"`
+	Nodes     []*DbNode `json:"nodes" xml:"Nodes>Node" yaml:"nodes" toml:"nodes"`
 	master    *DbNode
 	slaves    []*DbNode
 	circle    int
-	IsDefault bool `json:"is_default"`
+	IsDefault bool `json:"is_default" yaml:"is_default" toml:"is_default"`
+
+	PoolSettings `yaml:",inline"` //Default pool settings of nodes in group
 }
 
 func (d *DbGroup) in(mod int64) bool {
@@ -123,7 +163,7 @@ func (d *DbGroup) GetMaster() (*DbNode, error) {
 			return n, nil
 		}
 	}
-	return nil, fmt.Errorf("Group %s has no master node", d.Name)
+	return nil, &ShardError{Group: d.Name, Err: ErrNoMaster}
 }
 
 func (d *DbGroup) GetNode() *DbNode {
@@ -147,11 +187,13 @@ func (d *DbGroup) GetNode() *DbNode {
 
 //DbNode is a db instance on physical or virtual machine
 type DbNode struct {
-	Name    string   `json:"name"`
-	Db      *sql.DB  `json:"-"`
-	ConnStr string   `json:"conn_string"`
-	Type    NodeType `json:"node_type" xml:"NodeType"` //Indicates the node is master or salve node
-	Weight  int8     `json:"weight"`                   //Weight for slave node, if IsMaster=true, it is ignored
+	Name    string   `json:"name" yaml:"name" toml:"name"`
+	Db      *sql.DB  `json:"-" yaml:"-" toml:"-"`
+	ConnStr string   `json:"conn_string" yaml:"conn_string" toml:"conn_string"`
+	Type    NodeType `json:"node_type" xml:"NodeType" yaml:"node_type" toml:"node_type"` //Indicates the node is master or salve node
+	Weight  int8     `json:"weight" yaml:"weight" toml:"weight"`                         //Weight for slave node, if IsMaster=true, it is ignored
+
+	PoolSettings `yaml:",inline"`
 }
 
 func (d *DbNode) open(driver string) (err error) {
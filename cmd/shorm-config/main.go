@@ -0,0 +1,49 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command shorm-config validates shorm cluster config files.
+/*
+	Usage:
+		shorm-config check cluster_config.json [more config files...]
+
+	Exit code is 1 if any config file is invalid.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shengzhi/shorm"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: shorm-config check <config file>...")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "check" {
+		usage()
+	}
+	failed := false
+	for _, config := range os.Args[2:] {
+		if err := shorm.ValidateConfig(config); err != nil {
+			failed = true
+			fmt.Printf("%s: FAIL\n", config)
+			if problems, ok := err.(shorm.ConfigError); ok {
+				for _, p := range problems {
+					fmt.Printf("\t%s\n", p)
+				}
+			} else {
+				fmt.Printf("\t%v\n", err)
+			}
+			continue
+		}
+		fmt.Printf("%s: OK\n", config)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
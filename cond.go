@@ -0,0 +1,491 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Structured condition builder
+
+package shorm
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Cond is the condition expression of where clause,
+// column names are quoted by generator of the driver.
+/*
+	Usage:
+		// where `Age`>? and (`Name` like ? or `Email` is null)
+		session.WhereCond(shorm.And(
+			shorm.Gt("Age", 18),
+			shorm.Or(shorm.Like("Name", "sz%"), shorm.IsNull("Email")),
+		)).Find(&users)
+*/
+type Cond interface {
+	build(b *condBuilder)
+}
+
+type condBuilder struct {
+	buf  bytes.Buffer
+	args []interface{}
+	wrap func(string) string
+}
+
+//Quotes column name, qualified name like t.col is quoted part by part
+func (b *condBuilder) writeColumn(col string) {
+	b.buf.WriteString(wrapName(col, b.wrap))
+}
+
+//Quotes qualified name part by part
+func wrapName(name string, wrap func(string) string) string {
+	parts := strings.Split(name, ".")
+	for i := range parts {
+		parts[i] = wrap(parts[i])
+	}
+	return strings.Join(parts, ".")
+}
+
+//Generates sql and args of condition
+func genCond(cond Cond, wrap func(string) string) (string, []interface{}) {
+	b := &condBuilder{wrap: wrap}
+	cond.build(b)
+	return b.buf.String(), b.args
+}
+
+type compareCond struct {
+	col   string
+	op    string
+	value interface{}
+}
+
+func (c compareCond) build(b *condBuilder) {
+	b.writeColumn(c.col)
+	b.buf.WriteString(c.op)
+	b.buf.WriteString("?")
+	b.args = append(b.args, c.value)
+}
+
+// Eq equals < col=? >
+func Eq(col string, value interface{}) Cond { return compareCond{col, "=", value} }
+
+// Ne equals < col<>? >
+func Ne(col string, value interface{}) Cond { return compareCond{col, "<>", value} }
+
+// Gt equals < col>? >
+func Gt(col string, value interface{}) Cond { return compareCond{col, ">", value} }
+
+// Ge equals < col>=? >
+func Ge(col string, value interface{}) Cond { return compareCond{col, ">=", value} }
+
+// Lt equals < col<? >
+func Lt(col string, value interface{}) Cond { return compareCond{col, "<", value} }
+
+// Le equals < col<=? >
+func Le(col string, value interface{}) Cond { return compareCond{col, "<=", value} }
+
+// Like equals < col like ? >, pattern should contain wildcards
+func Like(col string, pattern string) Cond { return compareCond{col, " like ", pattern} }
+
+type nullCond struct {
+	col string
+	not bool
+}
+
+func (c nullCond) build(b *condBuilder) {
+	b.writeColumn(c.col)
+	if c.not {
+		b.buf.WriteString(" is not null")
+	} else {
+		b.buf.WriteString(" is null")
+	}
+}
+
+// IsNull equals < col is null >
+func IsNull(col string) Cond { return nullCond{col: col} }
+
+// IsNotNull equals < col is not null >
+func IsNotNull(col string) Cond { return nullCond{col: col, not: true} }
+
+type inCond struct {
+	col    string
+	values []interface{}
+	not    bool
+}
+
+func (c inCond) build(b *condBuilder) {
+	if len(c.values) <= 0 {
+		//nothing is in empty set
+		if c.not {
+			b.buf.WriteString("1=1")
+		} else {
+			b.buf.WriteString("1=0")
+		}
+		return
+	}
+	b.writeColumn(c.col)
+	if c.not {
+		b.buf.WriteString(" not")
+	}
+	b.buf.WriteString(" in (")
+	b.buf.WriteString(strings.TrimSuffix(strings.Repeat("?,", len(c.values)), ","))
+	b.buf.WriteString(")")
+	b.args = append(b.args, c.values...)
+}
+
+//Flattens single slice argument
+func flattenArgs(args []interface{}) []interface{} {
+	if len(args) != 1 {
+		return args
+	}
+	val := reflect.ValueOf(args[0])
+	if !val.IsValid() || val.Kind() != reflect.Slice || val.Type().Elem().Kind() == reflect.Uint8 {
+		return args
+	}
+	values := make([]interface{}, val.Len())
+	for i := range values {
+		values[i] = val.Index(i).Interface()
+	}
+	return values
+}
+
+// In equals < col in (?,?) >, values can be a slice or a subquery created by Sub
+func In(col string, values ...interface{}) Cond {
+	if len(values) == 1 {
+		if sub, ok := values[0].(*SubQuery); ok {
+			return inSubCond{col: col, sub: sub}
+		}
+	}
+	return inCond{col: col, values: flattenArgs(values)}
+}
+
+// NotIn equals < col not in (?,?) >, values can be a slice or a subquery created by Sub
+func NotIn(col string, values ...interface{}) Cond {
+	if len(values) == 1 {
+		if sub, ok := values[0].(*SubQuery); ok {
+			return inSubCond{col: col, sub: sub, not: true}
+		}
+	}
+	return inCond{col: col, values: flattenArgs(values), not: true}
+}
+
+type notCond struct {
+	cond Cond
+}
+
+func (c notCond) build(b *condBuilder) {
+	b.buf.WriteString("not (")
+	c.cond.build(b)
+	b.buf.WriteString(")")
+}
+
+// Not equals < not (cond) >
+func Not(cond Cond) Cond { return notCond{cond} }
+
+type groupCond struct {
+	op    string
+	conds []Cond
+}
+
+func (c groupCond) build(b *condBuilder) {
+	if len(c.conds) <= 0 {
+		if c.op == " and " {
+			b.buf.WriteString("1=1")
+		} else {
+			b.buf.WriteString("1=0")
+		}
+		return
+	}
+	if len(c.conds) == 1 {
+		c.conds[0].build(b)
+		return
+	}
+	b.buf.WriteString("(")
+	for i, cond := range c.conds {
+		if i > 0 {
+			b.buf.WriteString(c.op)
+		}
+		cond.build(b)
+	}
+	b.buf.WriteString(")")
+}
+
+// And equals < (cond1 and cond2) >
+func And(conds ...Cond) Cond { return groupCond{" and ", conds} }
+
+// Or equals < (cond1 or cond2) >
+func Or(conds ...Cond) Cond { return groupCond{" or ", conds} }
+
+type exprCond struct {
+	clause string
+	args   []interface{}
+}
+
+func (c exprCond) build(b *condBuilder) {
+	b.buf.WriteString("(")
+	b.buf.WriteString(c.clause)
+	b.buf.WriteString(")")
+	b.args = append(b.args, c.args...)
+}
+
+// Expr is raw sql condition which can be composed with other conditions
+func Expr(clause string, args ...interface{}) Cond { return exprCond{clause, args} }
+
+//valueGetter gets value of column to write into db, implemented by generators
+type valueGetter interface {
+	getValue(colMeta *columnMetadata, value reflect.Value) interface{}
+}
+
+//tableCond is the condition resolved against metadata of table by generator of the driver before generating sql
+type tableCond interface {
+	Cond
+	resolve(table *TableMetadata, gen SqlGenerator) (Cond, error)
+}
+
+//Called by build of tableCond, sessions always resolve conditions before generating sql,
+//so it is a bug to build tableCond, which must not be rendered into sql by guess
+func unresolved(c tableCond) {
+	panic(fmt.Sprintf("shorm: condition %T is built without resolving against table", c))
+}
+
+//Conditions of query-by-example struct
+type structCond struct {
+	model interface{}
+	cols  []string
+}
+
+func (c structCond) build(b *condBuilder) {
+	unresolved(c)
+}
+
+//Values are read by metadata of model, columns are checked against table queried
+func (c structCond) resolve(table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	getter, ok := gen.(valueGetter)
+	if !ok {
+		return nil, fmt.Errorf("WhereStruct is not supported by sql generator %T", gen)
+	}
+	meta, err := getTableMeta(c.model)
+	if err != nil {
+		return nil, err
+	}
+	value := reflect.Indirect(reflect.ValueOf(c.model))
+	var conds []Cond
+	if len(c.cols) > 0 {
+		for _, name := range c.cols {
+			key := strings.ToLower(strings.TrimSpace(name))
+			col, ok := meta.Columns[key]
+			tableCol, tableOk := table.Columns[key]
+			if !ok || !tableOk {
+				return nil, fmt.Errorf("%w %s of table %s", ErrUnknownColumn, name, table.Name)
+			}
+			conds = append(conds, Eq(tableCol.name, getter.getValue(col, value)))
+		}
+		return And(conds...), nil
+	}
+	meta.Columns.Foreach(func(key string, col *columnMetadata) {
+		field := value
+		if len(col.parentFieldIndex) > 0 {
+			field = field.FieldByIndex(col.parentFieldIndex)
+		}
+		if field.FieldByIndex(col.fieldIndex).IsZero() {
+			return
+		}
+		if err == nil {
+			if tableCol, ok := table.Columns[key]; ok {
+				conds = append(conds, Eq(tableCol.name, getter.getValue(col, value)))
+			} else {
+				err = fmt.Errorf("%w %s of table %s", ErrUnknownColumn, col.name, table.Name)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(conds) <= 0 {
+		//dropping the condition would make update or delete table-wide
+		return nil, fmt.Errorf("%w, all fields of %s are zero, list the columns to match zero values", ErrNoCondition, meta.Name)
+	}
+	return And(conds...), nil
+}
+
+//Conditions of column-value map
+type mapCond map[string]interface{}
+
+func (c mapCond) build(b *condBuilder) {
+	unresolved(c)
+}
+
+func (c mapCond) conds(colName func(key string) string) Cond {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	conds := make([]Cond, 0, len(keys))
+	for _, k := range keys {
+		v := c[k]
+		val := reflect.ValueOf(v)
+		switch {
+		case v == nil:
+			conds = append(conds, IsNull(colName(k)))
+		case val.Kind() == reflect.Slice && val.Type().Elem().Kind() != reflect.Uint8:
+			conds = append(conds, In(colName(k), v))
+		default:
+			conds = append(conds, Eq(colName(k), v))
+		}
+	}
+	return And(conds...)
+}
+
+//Empty map resolves to 1=1, which keeps Not and Or of it restricting as written
+func (c mapCond) resolve(table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	if len(c) <= 0 {
+		return And(), nil
+	}
+	for k := range c {
+		if _, ok := table.Columns[strings.ToLower(k)]; !ok {
+			return nil, fmt.Errorf("%w %s of table %s", ErrUnknownColumn, k, table.Name)
+		}
+	}
+	return c.conds(func(key string) string { return table.Columns[strings.ToLower(key)].name }), nil
+}
+
+//Resolves tableCond in condition tree
+func resolveCond(cond Cond, table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	switch c := cond.(type) {
+	case tableCond:
+		return c.resolve(table, gen)
+	case groupCond:
+		conds := make([]Cond, 0, len(c.conds))
+		for _, sub := range c.conds {
+			r, err := resolveCond(sub, table, gen)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, r)
+		}
+		return groupCond{c.op, conds}, nil
+	case notCond:
+		r, err := resolveCond(c.cond, table, gen)
+		if err != nil {
+			return nil, err
+		}
+		return notCond{r}, nil
+	}
+	return cond, nil
+}
+
+//Resolves conditions depending on metadata of table, e.g. WhereStruct, WhereMap and subqueries.
+//Clause of empty WhereMap is removed, so update or delete without other conditions is rejected.
+func (s *Session) resolveConds(table *TableMetadata) error {
+	list := s.clauseList[:0]
+	for _, c := range s.clauseList {
+		if m, ok := c.cond.(mapCond); ok && len(m) <= 0 {
+			continue
+		}
+		if c.cond != nil {
+			cond, err := resolveCond(c.cond, table, s.sqlGen)
+			if err != nil {
+				return err
+			}
+			c.cond = cond
+		}
+		list = append(list, c)
+	}
+	s.clauseList = list
+	return nil
+}
+
+//Gets metadata of model and resolves conditions against it
+func (s *Session) getTable(model interface{}) (*TableMetadata, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	table, err := getTableMeta(model)
+	if err != nil {
+		return nil, err
+	}
+	return table, s.resolveConds(table)
+}
+
+//Gets metadata of slice element and resolves conditions against it
+func (s *Session) getSliceTable(slicePtr interface{}) (*TableMetadata, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	table, err := getSliceTableMeta(slicePtr)
+	if err != nil {
+		return nil, err
+	}
+	return table, s.resolveConds(table)
+}
+
+// WhereCond equals < where cond >
+func (s SqlWhere) WhereCond(cond Cond) SqlWhere {
+	return append(s, sqlClause{op: opType_where, cond: cond})
+}
+
+// AndCond equals < and cond >
+func (s SqlWhere) AndCond(cond Cond) SqlWhere {
+	return append(s, sqlClause{op: opType_and, cond: cond})
+}
+
+// OrCond equals < or (cond) >
+func (s SqlWhere) OrCond(cond Cond) SqlWhere {
+	return append(s, sqlClause{op: opType_or, cond: cond})
+}
+
+// WhereStruct equals < where col1=? and col2=? >, conditions are built from the fields of model,
+// fields with non-zero value are used if cols not specified,
+// returns ErrUnknownColumn on executing if cols contains column not mapped by model,
+// or ErrNoCondition if cols not specified and all fields are zero.
+func (s SqlWhere) WhereStruct(model interface{}, cols ...string) SqlWhere {
+	return append(s, sqlClause{op: opType_where, cond: structCond{model, cols}})
+}
+
+// WhereMap equals < where col1=? and col2 in (?,?) and col3 is null >, key of map is column name,
+// nil value means is null, slice value means in.
+// Returns ErrUnknownColumn on executing if the column is not mapped by the model queried.
+// Empty map adds no condition.
+func (s SqlWhere) WhereMap(values map[string]interface{}) SqlWhere {
+	return append(s, sqlClause{op: opType_where, cond: mapCond(values)})
+}
+
+// WhereCond equals < where cond >
+func (s *Session) WhereCond(cond Cond) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_where, cond: cond})
+	return s
+}
+
+// AndCond equals < and cond >
+func (s *Session) AndCond(cond Cond) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_and, cond: cond})
+	return s
+}
+
+// OrCond equals < or (cond) >
+func (s *Session) OrCond(cond Cond) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_or, cond: cond})
+	return s
+}
+
+// WhereStruct equals < where col1=? and col2=? >, see SqlWhere.WhereStruct
+/*
+	Usage:
+		// where `UserName`=? and `Age`=?
+		session.WhereStruct(&User{UserName: "sz", Age: 18}).Find(&users)
+		// where `Age`=?, Age is 0
+		session.WhereStruct(&User{}, "Age").Find(&users)
+*/
+func (s *Session) WhereStruct(model interface{}, cols ...string) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_where, cond: structCond{model, cols}})
+	return s
+}
+
+// WhereMap equals < where col1=? and col2 in (?,?) and col3 is null >, see SqlWhere.WhereMap
+func (s *Session) WhereMap(values map[string]interface{}) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_where, cond: mapCond(values)})
+	return s
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Decoding of cluster config files
+
+package shorm
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of cluster config
+const (
+	ConfigFormat_JSON = "json"
+	ConfigFormat_XML  = "xml"
+	ConfigFormat_YAML = "yaml"
+	ConfigFormat_TOML = "toml"
+)
+
+// NewEngineFromReader creates Engine from config read from r with explicit format,
+// format is one of json, xml, yaml and toml, see NewEngineFromConfig for the config content.
+func NewEngineFromReader(r io.Reader, format string) (*Engine, error) {
+	cluster, err := decodeClusterConfig(r, format)
+	if err != nil {
+		return nil, err
+	}
+	if err = cluster.Cluster.Validate(); err != nil {
+		return nil, err
+	}
+	return NewEngine(cluster.Driver, cluster.Cluster), nil
+}
+
+func loadClusterConfig(config string) (*clusterConfig, error) {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(config)), ".")
+	if format == "yml" {
+		format = ConfigFormat_YAML
+	}
+	file, err := os.Open(config)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	cluster, err := decodeClusterConfig(file, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", config, err)
+	}
+	return cluster, nil
+}
+
+func decodeClusterConfig(r io.Reader, format string) (*clusterConfig, error) {
+	var cluster clusterConfig
+	var err error
+	switch strings.ToLower(format) {
+	case ConfigFormat_JSON:
+		err = json.NewDecoder(r).Decode(&cluster)
+	case ConfigFormat_XML:
+		err = xml.NewDecoder(r).Decode(&cluster)
+	case ConfigFormat_YAML:
+		var data []byte
+		if data, err = ioutil.ReadAll(r); err == nil {
+			err = yaml.Unmarshal(data, &cluster)
+		}
+	case ConfigFormat_TOML:
+		_, err = toml.DecodeReader(r, &cluster)
+	default:
+		return nil, fmt.Errorf("the format %q of config is not be supported", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cluster.Cluster == nil {
+		return nil, fmt.Errorf("no cluster defined in config")
+	}
+	if err = cluster.interpolate(); err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+var referencePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+//Replaces ${ENV_VAR} with value of environment variable,
+//and ${file:/path/to/secret} with content of the file.
+func interpolate(s string) (string, error) {
+	var err error
+	result := referencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := strings.TrimSpace(ref[2 : len(ref)-1])
+		if strings.HasPrefix(name, "file:") {
+			data, e := ioutil.ReadFile(strings.TrimPrefix(name, "file:"))
+			if e != nil {
+				err = fmt.Errorf("read secret %s occurs error:%v", ref, e)
+				return ref
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			err = fmt.Errorf("environment variable %s is not set", name)
+			return ref
+		}
+		return value
+	})
+	return result, err
+}
+
+func (c *clusterConfig) interpolate() (err error) {
+	fields := []*string{&c.Driver}
+	for _, g := range c.Cluster.Groups {
+		if g == nil {
+			continue
+		}
+		fields = append(fields, &g.Name)
+		for _, n := range g.Nodes {
+			if n != nil {
+				fields = append(fields, &n.Name, &n.ConnStr)
+			}
+		}
+	}
+	for _, f := range fields {
+		if *f, err = interpolate(*f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const yamlConfig = `
+driver: mysql
+cluster:
+  total_groups: 1
+  groups:
+    - name: group1
+      is_default: true
+      range_from: 0
+      range_to: 1
+      nodes:
+        - name: g1_master
+          conn_string: "user:${SHORM_TEST_PWD}@/test"
+          node_type: master
+        - name: g1_node1
+          conn_string: "user:${file:%s}@/test"
+          node_type: slave
+`
+
+const tomlConfig = `
+driver = "mysql"
+[cluster]
+total_groups = 1
+[[cluster.groups]]
+name = "group1"
+range_to = 1
+[[cluster.groups.nodes]]
+name = "g1_master"
+conn_string = "user:${SHORM_TEST_PWD}@/test"
+node_type = "master"
+`
+
+func TestDecodeClusterConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shorm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	if err = ioutil.WriteFile(secret, []byte("filepwd\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SHORM_TEST_PWD", "envpwd")
+	defer os.Unsetenv("SHORM_TEST_PWD")
+
+	cfg, err := decodeClusterConfig(strings.NewReader(strings.Replace(yamlConfig, "%s", secret, 1)), ConfigFormat_YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := cfg.Cluster.Groups[0].Nodes
+	if cfg.Driver != "mysql" || !cfg.Cluster.Groups[0].IsDefault || len(nodes) != 2 {
+		t.Fatalf("unexpected yaml config: %+v", cfg)
+	}
+	if nodes[0].ConnStr != "user:envpwd@/test" || nodes[1].ConnStr != "user:filepwd@/test" {
+		t.Errorf("unexpected connection strings %q, %q", nodes[0].ConnStr, nodes[1].ConnStr)
+	}
+	if nodes[1].Type != NodeType_Slave {
+		t.Errorf("expected slave node, but %q", nodes[1].Type)
+	}
+
+	cfg, err = decodeClusterConfig(strings.NewReader(tomlConfig), ConfigFormat_TOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Cluster.TotalGroups != 1 || cfg.Cluster.Groups[0].Nodes[0].ConnStr != "user:envpwd@/test" {
+		t.Errorf("unexpected toml config: %+v", cfg.Cluster.Groups[0].Nodes[0])
+	}
+
+	_, err = decodeClusterConfig(strings.NewReader(strings.Replace(tomlConfig, "SHORM_TEST_PWD", "SHORM_TEST_MISSING", 1)), ConfigFormat_TOML)
+	if err == nil || !strings.Contains(err.Error(), "SHORM_TEST_MISSING") {
+		t.Errorf("expected missing environment variable error, but %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Read-your-writes consistency between sessions
+
+package shorm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultConsistencyWindow is the time that reads carrying a consistency token
+// are routed to master after a write on the same group.
+const DefaultConsistencyWindow = time.Second * 5
+
+// ConsistencyToken records which db groups have been written and when.
+// Pass it to another session by calling Session.Consistent, reads against the
+// written groups will touch master node until the consistency window expires.
+/*
+	Usage:
+		s := engine.StartSession()
+		s.Insert(&user)
+		token := s.ConsistencyToken()
+		engine.EndSession(s)
+
+		s2 := engine.StartSession()
+		defer engine.EndSession(s2)
+		s2.Consistent(token).Id(user.Id).Get(&user)
+*/
+type ConsistencyToken struct {
+	lock   sync.RWMutex
+	writes map[string]time.Time
+}
+
+// NewConsistencyToken creates an empty consistency token
+func NewConsistencyToken() *ConsistencyToken {
+	return &ConsistencyToken{writes: make(map[string]time.Time)}
+}
+
+//Identifies group by name and shard range, as name is optional in config
+func groupKey(group *DbGroup) string {
+	return fmt.Sprintf("%s[%d,%d)", group.Name, group.RangeFrom, group.RangeTo)
+}
+
+func (t *ConsistencyToken) markWrite(group *DbGroup) {
+	if t == nil || group == nil {
+		return
+	}
+	t.lock.Lock()
+	t.writes[groupKey(group)] = time.Now()
+	t.lock.Unlock()
+}
+
+// Merge copies the write records of other token into t, keeps the latest one for each group
+func (t *ConsistencyToken) Merge(other *ConsistencyToken) {
+	if t == nil || other == nil || t == other {
+		return
+	}
+	other.lock.RLock()
+	defer other.lock.RUnlock()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for name, at := range other.writes {
+		if at.After(t.writes[name]) {
+			t.writes[name] = at
+		}
+	}
+}
+
+// IsEmpty reports whether the token has no write record
+func (t *ConsistencyToken) IsEmpty() bool {
+	if t == nil {
+		return true
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.writes) <= 0
+}
+
+func (t *ConsistencyToken) requireMaster(group *DbGroup, window time.Duration) bool {
+	if t == nil || group == nil {
+		return false
+	}
+	t.lock.RLock()
+	at, ok := t.writes[groupKey(group)]
+	t.lock.RUnlock()
+	return ok && time.Since(at) < window
+}
+
+type consistencyKey struct{}
+
+// ContextWithToken returns a copy of ctx which carries the consistency token
+func ContextWithToken(ctx context.Context, token *ConsistencyToken) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, token)
+}
+
+// TokenFromContext returns the consistency token stored in ctx, nil if not exists
+func TokenFromContext(ctx context.Context) *ConsistencyToken {
+	token, _ := ctx.Value(consistencyKey{}).(*ConsistencyToken)
+	return token
+}
+
+// SetConsistencyWindow sets how long reads carrying a consistency token stick to master node
+func (e *Engine) SetConsistencyWindow(window time.Duration) {
+	e.consistencyWindow = window
+}
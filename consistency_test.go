@@ -0,0 +1,48 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsistencyTokenGroups(t *testing.T) {
+	g1 := &DbGroup{RangeFrom: 0, RangeTo: 5}
+	g2 := &DbGroup{RangeFrom: 5, RangeTo: 10}
+	token := NewConsistencyToken()
+	token.markWrite(g1)
+	if !token.requireMaster(g1, time.Minute) {
+		t.Errorf("requireMaster(g1) = false, want true")
+	}
+	if token.requireMaster(g2, time.Minute) {
+		t.Errorf("requireMaster(g2) = true, want false as groups without name are different")
+	}
+	other := NewConsistencyToken()
+	other.Merge(token)
+	if !other.requireMaster(g1, time.Minute) || other.requireMaster(g1, 0) {
+		t.Errorf("merged token does not keep write of g1 within window")
+	}
+}
+
+func TestSessionConsistencyTokenConcurrent(t *testing.T) {
+	s := &Session{}
+	groups := []*DbGroup{{Name: "g1", RangeFrom: 0, RangeTo: 5}, {Name: "g2", RangeFrom: 5, RangeTo: 10}}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(group *DbGroup) {
+			defer wg.Done()
+			s.markWrite(group)
+		}(groups[i%2])
+	}
+	wg.Wait()
+	for _, group := range groups {
+		if !s.ConsistencyToken().requireMaster(group, time.Minute) {
+			t.Errorf("write of group %s is lost", group.Name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Common table expressions
+
+package shorm
+
+import (
+	"strings"
+)
+
+//Common table expression < name as (select ...) >
+type withCond struct {
+	name string
+	sub  *SubQuery
+}
+
+func (c withCond) build(b *condBuilder) {
+	unresolved(c)
+}
+
+func (c withCond) resolve(table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	sqlStr, args, err := c.sub.render(gen)
+	if err != nil {
+		return nil, err
+	}
+	return rawCond{c.name + " as (" + sqlStr + ")", args}, nil
+}
+
+//Generates with clause prepended to select, keyword is the one of driver for recursive expressions.
+//Expressions are kept in order of declaration as later ones may reference earlier ones.
+func (m *BaseGenerator) genWith(sqls sqlClauseList, recursiveKeyword string) (string, []interface{}) {
+	var list []string
+	var args []interface{}
+	keyword := "with "
+	for _, s := range sqls {
+		if s.op != opType_with && s.op != opType_withRecursive {
+			continue
+		}
+		if s.op == opType_withRecursive {
+			keyword = recursiveKeyword
+		}
+		clause, params := s.clause, s.params
+		if s.cond != nil {
+			clause, params = genCond(s.cond, m.wrapColumn)
+		}
+		list = append(list, clause)
+		args = append(args, params...)
+	}
+	if len(list) <= 0 {
+		return "", nil
+	}
+	return keyword + strings.Join(list, ",") + " ", args
+}
+
+// Table specifies the table queried, e.g. name of common table expression
+func (s SqlWhere) Table(name string) SqlWhere {
+	return append(s, sqlClause{op: opType_table, clause: name})
+}
+
+// With equals < with name as (select ...) >, the expression can be queried by Table(name)
+// and results are mapped to model of the outer query.
+// Supported by mysql 8, postgres, sqlite and mssql.
+func (s SqlWhere) With(name string, sub *SubQuery) SqlWhere {
+	return append(s, sqlClause{op: opType_with, cond: withCond{name, sub}})
+}
+
+// WithRecursive equals < with recursive name as (select ... union all select ...) >,
+// the recursive member joins the expression by name, see Session.WithRecursive
+func (s SqlWhere) WithRecursive(name string, sub *SubQuery) SqlWhere {
+	return append(s, sqlClause{op: opType_withRecursive, cond: withCond{name, sub}})
+}
+
+// With equals < with name as (select ...) >, see SqlWhere.With
+func (s *Session) With(name string, sub *SubQuery) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_with, cond: withCond{name, sub}})
+	return s
+}
+
+// WithRecursive equals < with recursive name as (select ... union all select ...) >,
+// keyword recursive is omitted for mssql.
+/*
+	Usage:
+		// with recursive tree as (select ... from `T_Category` where ParentId=?
+		//	union all select c.`Id`,... from `T_Category` c join `tree` t on c.ParentId=t.Id)
+		// select ... from tree
+		tree := shorm.Sub(&Category{}, shorm.W().Where("ParentId=?", rootId).
+			UnionAll(shorm.Sub(&Category{}, shorm.W().Alias("c").Join("tree", "t", "c.ParentId=t.Id"))))
+		err := session.WithRecursive("tree", tree).Table("tree").Find(&categories)
+*/
+func (s *Session) WithRecursive(name string, sub *SubQuery) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_withRecursive, cond: withCond{name, sub}})
+	return s
+}
@@ -0,0 +1,654 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Distributed transaction across db groups
+
+package shorm
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// States of distributed transaction in coordinator log
+const (
+	TransState_Preparing  = "preparing"  //branches are being prepared, will be rolled back on recovery
+	TransState_Committing = "committing" //all branches prepared, will be committed on recovery
+	TransState_Aborting   = "aborting"   //will be rolled back on recovery
+	TransState_Done       = "done"       //finished, nothing to recover
+)
+
+// TransRecord is the record of distributed transaction written into coordinator log
+type TransRecord struct {
+	Xid      string            `json:"xid"`
+	State    string            `json:"state"`
+	Branches map[string]string `json:"branches"` //group name -> branch xid
+	Time     time.Time         `json:"time"`
+}
+
+// TransLog is the durable coordinator log of distributed transactions.
+// Write must not return until the record is persisted.
+type TransLog interface {
+	Write(record TransRecord) error
+	//Pending returns the last record of every transaction which is not done
+	Pending() ([]TransRecord, error)
+}
+
+// FileTransLog is TransLog which appends records as json lines to local file
+type FileTransLog struct {
+	lock sync.Mutex
+	path string
+}
+
+// NewFileTransLog creates coordinator log on file path
+func NewFileTransLog(path string) *FileTransLog {
+	return &FileTransLog{path: path}
+}
+
+func (l *FileTransLog) Write(record TransRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (l *FileTransLog) Pending() ([]TransRecord, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	last := make(map[string]TransRecord)
+	var order []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record TransRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			//the last line may be incomplete if process crashed while writing
+			continue
+		}
+		if _, ok := last[record.Xid]; !ok {
+			order = append(order, record.Xid)
+		}
+		last[record.Xid] = record
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	var pending []TransRecord
+	for _, xid := range order {
+		if last[xid].State != TransState_Done {
+			pending = append(pending, last[xid])
+		}
+	}
+	return pending, nil
+}
+
+// SetTransLog sets coordinator log of distributed transactions,
+// without it, transactions interrupted by crash can not be recovered.
+func (e *Engine) SetTransLog(log TransLog) {
+	e.transLog = log
+}
+
+//Two-phase commit protocol of database
+type xaDialect interface {
+	begin(conn *sql.Conn, xid string) error
+	prepare(conn *sql.Conn, xid string) error
+	commit(db *sql.DB, xid string) error
+	//commits branch without prepare, used when transaction has single branch
+	commitOnePhase(conn *sql.Conn, xid string) error
+	rollback(conn *sql.Conn, xid string) error
+	rollbackPrepared(db *sql.DB, xid string) error
+	//reports whether err is returned as the prepared branch does not exist, which is finished already
+	unknownXid(err error) bool
+}
+
+var xaDialectDict = map[string]xaDialect{
+	"mysql":    mysqlXA{},
+	"mymysql":  mysqlXA{},
+	"postgres": postgresXA{},
+}
+
+type mysqlXA struct{}
+
+func (mysqlXA) begin(conn *sql.Conn, xid string) error {
+	_, err := conn.ExecContext(context.Background(), fmt.Sprintf("XA START '%s'", xid))
+	return err
+}
+
+func (mysqlXA) prepare(conn *sql.Conn, xid string) error {
+	if _, err := conn.ExecContext(context.Background(), fmt.Sprintf("XA END '%s'", xid)); err != nil {
+		return err
+	}
+	_, err := conn.ExecContext(context.Background(), fmt.Sprintf("XA PREPARE '%s'", xid))
+	return err
+}
+
+func (mysqlXA) commit(db *sql.DB, xid string) error {
+	_, err := db.Exec(fmt.Sprintf("XA COMMIT '%s'", xid))
+	return err
+}
+
+func (mysqlXA) commitOnePhase(conn *sql.Conn, xid string) error {
+	if _, err := conn.ExecContext(context.Background(), fmt.Sprintf("XA END '%s'", xid)); err != nil {
+		return err
+	}
+	_, err := conn.ExecContext(context.Background(), fmt.Sprintf("XA COMMIT '%s' ONE PHASE", xid))
+	return err
+}
+
+func (mysqlXA) rollback(conn *sql.Conn, xid string) error {
+	conn.ExecContext(context.Background(), fmt.Sprintf("XA END '%s'", xid))
+	_, err := conn.ExecContext(context.Background(), fmt.Sprintf("XA ROLLBACK '%s'", xid))
+	return err
+}
+
+func (mysqlXA) rollbackPrepared(db *sql.DB, xid string) error {
+	_, err := db.Exec(fmt.Sprintf("XA ROLLBACK '%s'", xid))
+	return err
+}
+
+//ER_XAER_NOTA: Unknown XID
+func (mysqlXA) unknownXid(err error) bool {
+	number, ok := driverErrorNumber(err)
+	return ok && number == 1397
+}
+
+type postgresXA struct{}
+
+func (postgresXA) begin(conn *sql.Conn, xid string) error {
+	_, err := conn.ExecContext(context.Background(), "BEGIN")
+	return err
+}
+
+func (postgresXA) prepare(conn *sql.Conn, xid string) error {
+	_, err := conn.ExecContext(context.Background(), fmt.Sprintf("PREPARE TRANSACTION '%s'", xid))
+	return err
+}
+
+func (postgresXA) commit(db *sql.DB, xid string) error {
+	_, err := db.Exec(fmt.Sprintf("COMMIT PREPARED '%s'", xid))
+	return err
+}
+
+func (postgresXA) commitOnePhase(conn *sql.Conn, xid string) error {
+	_, err := conn.ExecContext(context.Background(), "COMMIT")
+	return err
+}
+
+func (postgresXA) rollback(conn *sql.Conn, xid string) error {
+	_, err := conn.ExecContext(context.Background(), "ROLLBACK")
+	return err
+}
+
+func (postgresXA) rollbackPrepared(db *sql.DB, xid string) error {
+	_, err := db.Exec(fmt.Sprintf("ROLLBACK PREPARED '%s'", xid))
+	return err
+}
+
+//undefined_object: prepared transaction with identifier does not exist
+func (postgresXA) unknownXid(err error) bool {
+	state, ok := driverErrorState(err)
+	return ok && state == "42704"
+}
+
+//Adapts *sql.Conn to sqlExecutor
+type connExecutor struct {
+	conn *sql.Conn
+}
+
+func (c connExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (c connExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.QueryContext(context.Background(), query, args...)
+}
+
+func (c connExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+func (c connExecutor) Prepare(query string) (*sql.Stmt, error) {
+	return c.conn.PrepareContext(context.Background(), query)
+}
+
+//Local transaction of distributed transaction on one db group
+type transBranch struct {
+	group    *DbGroup
+	node     *DbNode
+	xid      string
+	conn     *sql.Conn //used by two-phase commit
+	tx       *sql.Tx   //used by best-effort commit
+	exec     sqlExecutor
+	prepared bool
+}
+
+// DistributedTrans is the transaction across db groups.
+// Local transaction is begun lazily on master node of each group touched by statements,
+// statements are routed by sharding value as Session does.
+// On mysql(XA) and postgres(PREPARE TRANSACTION), Commit uses two-phase commit,
+// on other drivers, local transactions are committed one by one in the order of beginning,
+// which does not guarantee atomicity if some commits fail.
+/*
+	Usage:
+		engine.SetTransLog(shorm.NewFileTransLog("/var/lib/app/shorm_trans.log"))
+		engine.RecoverDistributedTrans()
+
+		trans, err := engine.BeginDistributedTrans()
+		if err = trans.Insert(&order); err != nil {
+			trans.Rollback()
+			return
+		}
+		if err = trans.ShardValue(user.Id).Id(user.Id).Cols("Balance").Update(&user); err != nil {
+			trans.Rollback()
+			return
+		}
+		err = trans.Commit()
+*/
+type DistributedTrans struct {
+	engine   *Engine
+	session  *Session
+	dialect  xaDialect
+	xid      string
+	branches []*transBranch
+	done     bool
+}
+
+// BeginDistributedTrans begins a distributed transaction
+func (e *Engine) BeginDistributedTrans() (*DistributedTrans, error) {
+	xid, err := newXid()
+	if err != nil {
+		return nil, err
+	}
+	return &DistributedTrans{
+		engine:  e,
+		session: e.StartSession(),
+		dialect: xaDialectDict[e.driver],
+		xid:     xid,
+	}, nil
+}
+
+func newXid() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("shorm_%d_%s", time.Now().Unix(), hex.EncodeToString(b)), nil
+}
+
+//Gets the branch on group, begins local transaction if not exists
+func (d *DistributedTrans) branch(group *DbGroup) (*transBranch, error) {
+	if d.done {
+		return nil, fmt.Errorf("distributed transaction %s has been finished", d.xid)
+	}
+	for _, b := range d.branches {
+		if b.group == group {
+			return b, nil
+		}
+	}
+	node, err := group.GetMaster()
+	if err != nil {
+		return nil, err
+	}
+	b := &transBranch{
+		group: group,
+		node:  node,
+		xid:   fmt.Sprintf("%s_%d", d.xid, len(d.branches)),
+	}
+	if d.dialect != nil {
+		if b.conn, err = node.Db.Conn(context.Background()); err != nil {
+			return nil, err
+		}
+		if err = d.dialect.begin(b.conn, b.xid); err != nil {
+			b.conn.Close()
+			return nil, err
+		}
+		b.exec = connExecutor{b.conn}
+	} else {
+		if b.tx, err = node.Db.Begin(); err != nil {
+			return nil, err
+		}
+		b.exec = b.tx
+	}
+	d.session.logger.Printf("distributed transaction %s begins branch %s on node %s\r\n", d.xid, b.xid, node.Name)
+	d.branches = append(d.branches, b)
+	return b, nil
+}
+
+//Gets the branch of next statement, uses default group if no sharding value specified
+func (d *DistributedTrans) defaultBranch() (*transBranch, error) {
+	if d.session.err != nil {
+		return nil, d.session.err
+	}
+	if d.session.group == nil {
+		group, err := d.session.cluster.DefaultGroup()
+		if err != nil {
+			return nil, err
+		}
+		d.session.group = group
+	}
+	return d.branch(d.session.group)
+}
+
+//Gets the branch of next statement according to model
+func (d *DistributedTrans) modelBranch(model interface{}) (*transBranch, error) {
+	table, value, err := d.session.getTableAndValue(model)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.session.locateGroup(model, value, table); err != nil {
+		return nil, err
+	}
+	return d.defaultBranch()
+}
+
+// ShardValue specifies sharding value of next statement
+func (d *DistributedTrans) ShardValue(value int64) *DistributedTrans {
+	d.session.ShardValue(value)
+	return d
+}
+
+func (d *DistributedTrans) Table(name string) *DistributedTrans {
+	d.session.Table(name)
+	return d
+}
+
+func (d *DistributedTrans) Cols(cols string) *DistributedTrans {
+	d.session.Cols(cols)
+	return d
+}
+
+func (d *DistributedTrans) Omit(cols string) *DistributedTrans {
+	d.session.Omit(cols)
+	return d
+}
+
+func (d *DistributedTrans) Id(id interface{}) *DistributedTrans {
+	d.session.Id(id)
+	return d
+}
+
+func (d *DistributedTrans) Where(clause string, args ...interface{}) *DistributedTrans {
+	d.session.Where(clause, args...)
+	return d
+}
+
+func (d *DistributedTrans) And(clause string, args ...interface{}) *DistributedTrans {
+	d.session.And(clause, args...)
+	return d
+}
+
+func (d *DistributedTrans) WhereCond(cond Cond) *DistributedTrans {
+	d.session.WhereCond(cond)
+	return d
+}
+
+func (d *DistributedTrans) AndCond(cond Cond) *DistributedTrans {
+	d.session.AndCond(cond)
+	return d
+}
+
+func (d *DistributedTrans) In(colName string, args ...interface{}) *DistributedTrans {
+	d.session.In(colName, args...)
+	return d
+}
+
+func (d *DistributedTrans) Exec(sql string, args ...interface{}) *DistributedTrans {
+	d.session.Exec(sql, args...)
+	return d
+}
+
+func (d *DistributedTrans) Insert(model interface{}) error {
+	b, err := d.modelBranch(model)
+	if err != nil {
+		d.session.reset()
+		return err
+	}
+	return d.session.insertWithTx(b.exec, model)
+}
+
+func (d *DistributedTrans) Update(model interface{}) error {
+	b, err := d.modelBranch(model)
+	if err != nil {
+		d.session.reset()
+		return err
+	}
+	return d.session.updateWithTx(b.exec, model)
+}
+
+// Delete deletes records on the group located by sharding value, or default group if not specified
+func (d *DistributedTrans) Delete(model interface{}) error {
+	b, err := d.defaultBranch()
+	if err != nil {
+		d.session.reset()
+		return err
+	}
+	return d.session.deleteWithTx(b.exec, model)
+}
+
+// Get retrieves one record on the group located by sharding value, or default group if not specified
+func (d *DistributedTrans) Get(model interface{}) (bool, error) {
+	b, err := d.defaultBranch()
+	if err != nil {
+		d.session.reset()
+		return false, err
+	}
+	return d.session.getWithTx(b.exec, model)
+}
+
+// Find retrieves records on the group located by sharding value, or default group if not specified
+func (d *DistributedTrans) Find(slicePtr interface{}) error {
+	b, err := d.defaultBranch()
+	if err != nil {
+		d.session.reset()
+		return err
+	}
+	return d.session.findWithTx(b.exec, slicePtr)
+}
+
+func (d *DistributedTrans) record(state string) error {
+	if d.engine.transLog == nil {
+		return nil
+	}
+	record := TransRecord{Xid: d.xid, State: state, Branches: make(map[string]string), Time: time.Now()}
+	for _, b := range d.branches {
+		record.Branches[b.group.Name] = b.xid
+	}
+	return d.engine.transLog.Write(record)
+}
+
+func (d *DistributedTrans) finish() {
+	d.done = true
+	for _, b := range d.branches {
+		if b.conn != nil {
+			b.conn.Close()
+		}
+	}
+	d.engine.EndSession(d.session)
+}
+
+// Commit commits all local transactions
+func (d *DistributedTrans) Commit() error {
+	if d.done {
+		return fmt.Errorf("distributed transaction %s has been finished", d.xid)
+	}
+	defer d.finish()
+	if d.dialect == nil {
+		return d.commitInOrder()
+	}
+	if len(d.branches) == 1 {
+		//one phase is enough for single branch, nothing is left prepared for recovery
+		b := d.branches[0]
+		if err := d.dialect.commitOnePhase(b.conn, b.xid); err != nil {
+			d.dialect.rollback(b.conn, b.xid)
+			return err
+		}
+		return nil
+	}
+
+	if err := d.record(TransState_Preparing); err != nil {
+		d.rollbackAll()
+		return err
+	}
+	for _, b := range d.branches {
+		if err := d.dialect.prepare(b.conn, b.xid); err != nil {
+			d.record(TransState_Aborting)
+			d.rollbackAll()
+			d.record(TransState_Done)
+			return fmt.Errorf("prepare branch %s on node %s occurs error:%v", b.xid, b.node.Name, err)
+		}
+		b.prepared = true
+	}
+	if err := d.record(TransState_Committing); err != nil {
+		d.rollbackAll()
+		d.record(TransState_Done)
+		return err
+	}
+	var errs []error
+	for _, b := range d.branches {
+		if err := d.dialect.commit(b.node.Db, b.xid); err != nil {
+			errs = append(errs, fmt.Errorf("commit branch %s on node %s occurs error:%v", b.xid, b.node.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		//the decision has been logged, branches will be committed by RecoverDistributedTrans
+		return fmt.Errorf("distributed transaction %s is partially committed, recover it later: %v", d.xid, errs)
+	}
+	return d.record(TransState_Done)
+}
+
+func (d *DistributedTrans) commitInOrder() error {
+	for i, b := range d.branches {
+		if err := b.tx.Commit(); err != nil {
+			for _, rest := range d.branches[i+1:] {
+				rest.tx.Rollback()
+			}
+			if i > 0 {
+				return fmt.Errorf("distributed transaction %s is partially committed, %d of %d branches committed, commit branch on node %s occurs error:%v",
+					d.xid, i, len(d.branches), b.node.Name, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DistributedTrans) rollbackAll() error {
+	var errs []error
+	for _, b := range d.branches {
+		var err error
+		switch {
+		case b.tx != nil:
+			err = b.tx.Rollback()
+		case b.prepared:
+			err = d.dialect.rollbackPrepared(b.node.Db, b.xid)
+		default:
+			err = d.dialect.rollback(b.conn, b.xid)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rollback branch %s on node %s occurs error:%v", b.xid, b.node.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// Rollback rolls back all local transactions
+func (d *DistributedTrans) Rollback() error {
+	if d.done {
+		return fmt.Errorf("distributed transaction %s has been finished", d.xid)
+	}
+	defer d.finish()
+	return d.rollbackAll()
+}
+
+// RecoverDistributedTrans finishes the distributed transactions interrupted by crash according to trans log,
+// transactions which have been decided to commit are committed, others are rolled back.
+// It should be called after engine opened and before new distributed transactions begin.
+// Branch unknown to database is regarded as finished, transactions with branches failed by other errors
+// are left pending and the errors are returned, call it again to retry.
+func (e *Engine) RecoverDistributedTrans() error {
+	dialect := xaDialectDict[e.driver]
+	if e.transLog == nil || dialect == nil {
+		return nil
+	}
+	pending, err := e.transLog.Pending()
+	if err != nil {
+		return err
+	}
+	cluster := e.getCluster()
+	var errs []error
+	for _, record := range pending {
+		failed := false
+		for groupName, xid := range record.Branches {
+			var group *DbGroup
+			for _, g := range cluster.Groups {
+				if g.Name == groupName {
+					group = g
+				}
+			}
+			if group == nil {
+				errs = append(errs, fmt.Errorf("transaction %s: group %s not found", record.Xid, groupName))
+				failed = true
+				continue
+			}
+			node, err := group.GetMaster()
+			if err != nil {
+				errs = append(errs, err)
+				failed = true
+				continue
+			}
+			if record.State == TransState_Committing {
+				err = dialect.commit(node.Db, xid)
+			} else {
+				err = dialect.rollbackPrepared(node.Db, xid)
+			}
+			e.Logger.Printf("recover branch %s of transaction %s(%s): %v\r\n", xid, record.Xid, record.State, err)
+			//unknown branch is finished or never prepared, others are left pending for next recovery
+			if err != nil && !dialect.unknownXid(err) {
+				errs = append(errs, &ShardError{Group: group.Name, Node: node.Name,
+					Err: fmt.Errorf("recover branch %s of transaction %s: %w", xid, record.Xid, err)})
+				failed = true
+			}
+		}
+		if !failed {
+			record.State = TransState_Done
+			record.Time = time.Now()
+			if err = e.transLog.Write(record); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("recover distributed transactions occurs error:%w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileTransLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trans.log")
+	log := NewFileTransLog(path)
+	if pending, err := log.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("Pending() of missing file = %v, %v, want empty", pending, err)
+	}
+	records := []TransRecord{
+		{Xid: "x1", State: TransState_Preparing, Branches: map[string]string{"g1": "x1_0"}},
+		{Xid: "x2", State: TransState_Preparing},
+		{Xid: "x1", State: TransState_Committing, Branches: map[string]string{"g1": "x1_0", "g2": "x1_1"}},
+		{Xid: "x2", State: TransState_Done},
+	}
+	for _, record := range records {
+		if err := log.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//incomplete line written by crash is skipped
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString(`{"xid":"x3","sta`)
+	file.Close()
+
+	pending, err := log.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Xid != "x1" || pending[0].State != TransState_Committing || len(pending[0].Branches) != 2 {
+		t.Errorf("Pending() = %+v, want the committing record of x1", pending)
+	}
+}
+
+//Creates engine of groups whose master nodes are fake dbs, shard value i is routed to group i
+func newFakeGroupsEngine(driver string, groups int) (*Engine, []*fakeDb) {
+	cluster := &Cluster{TotalGroups: groups}
+	var dbs []*fakeDb
+	for i := 0; i < groups; i++ {
+		f, db, dsn := openFakeDb()
+		dbs = append(dbs, f)
+		cluster.Groups = append(cluster.Groups, &DbGroup{Name: fmt.Sprintf("g%d", i+1), RangeFrom: int64(i), RangeTo: int64(i + 1),
+			Nodes: []*DbNode{{Name: "master", ConnStr: dsn, Type: NodeType_Master, Db: db}}})
+	}
+	return NewEngine(driver, cluster), dbs
+}
+
+func TestDistributedTransBranches(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	log := NewFileTransLog(filepath.Join(t.TempDir(), "trans.log"))
+	engine.SetTransLog(log)
+	trans, err := engine.BeginDistributedTrans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = trans.Insert(&genUser{Id: 0, UserName: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = trans.Insert(&genUser{Id: 1, UserName: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = trans.ShardValue(1).Id(1).Delete(&genUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = trans.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for i, db := range dbs {
+		stmts := db.log()
+		if n := strings.Count(stmts, "insert into"); n != 1 {
+			t.Errorf("group %d executed %d inserts, want 1: %s", i, n, stmts)
+		}
+		if strings.Contains(stmts, "delete") != (i == 1) {
+			t.Errorf("delete is not routed to group 2: %s", stmts)
+		}
+		if !strings.Contains(stmts, "XA PREPARE") || !strings.Contains(stmts, "XA COMMIT") {
+			t.Errorf("group %d is not committed by two phases: %s", i, stmts)
+		}
+	}
+	if pending, _ := log.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() = %+v after commit, want empty", pending)
+	}
+}
+
+func TestDistributedTransOnePhase(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	path := filepath.Join(t.TempDir(), "trans.log")
+	engine.SetTransLog(NewFileTransLog(path))
+	trans, _ := engine.BeginDistributedTrans()
+	if err := trans.Insert(&genUser{Id: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := trans.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	stmts := dbs[1].log()
+	if strings.Contains(stmts, "XA PREPARE") || !strings.HasSuffix(stmts, "ONE PHASE") {
+		t.Errorf("single branch is not committed by one phase: %s", stmts)
+	}
+	if dbs[0].log() != "" {
+		t.Errorf("group 1 is touched: %s", dbs[0].log())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("coordinator log is written for single branch")
+	}
+}
+
+func TestDistributedTransRoutingError(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	//shard value 2 is out of all groups and there is no default group
+	engine.getCluster().TotalGroups = 3
+	trans, _ := engine.BeginDistributedTrans()
+	defer trans.Rollback()
+	if err := trans.Insert(&genUser{Id: 2}); !errors.Is(err, ErrNoDefaultGroup) {
+		t.Errorf("Insert() error = %v, want ErrNoDefaultGroup", err)
+	}
+	if err := trans.ShardValue(2).Id(2).Delete(&genUser{}); !errors.Is(err, ErrNoDefaultGroup) {
+		t.Errorf("Delete() error = %v, want ErrNoDefaultGroup", err)
+	}
+	for i, db := range dbs {
+		if db.log() != "" {
+			t.Errorf("group %d is touched: %s", i, db.log())
+		}
+	}
+}
+
+//Error of fake driver exposing error number as mysql driver does
+type fakeNumberError struct {
+	Number uint16
+}
+
+func (e *fakeNumberError) Error() string { return fmt.Sprintf("error %d", e.Number) }
+
+func TestRecoverDistributedTrans(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	log := NewFileTransLog(filepath.Join(t.TempDir(), "trans.log"))
+	engine.SetTransLog(log)
+	log.Write(TransRecord{Xid: "x1", State: TransState_Committing, Branches: map[string]string{"g1": "x1_0", "g2": "x1_1"}})
+	//branch of g1 has been committed, g2 is unreachable
+	dbs[0].exec = func(string, []driver.Value) (int64, error) { return 0, &fakeNumberError{1397} }
+	dbs[1].exec = func(string, []driver.Value) (int64, error) { return 0, driver.ErrBadConn }
+	err := engine.RecoverDistributedTrans()
+	var shardErr *ShardError
+	if !errors.As(err, &shardErr) || shardErr.Group != "g2" {
+		t.Fatalf("RecoverDistributedTrans() error = %v, want error of g2", err)
+	}
+	if pending, _ := log.Pending(); len(pending) != 1 {
+		t.Fatalf("Pending() = %+v, want the record left pending", pending)
+	}
+
+	dbs[1].exec = nil
+	if err = engine.RecoverDistributedTrans(); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := log.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() = %+v after recovery, want empty", pending)
+	}
+	if !strings.Contains(dbs[1].log(), "XA COMMIT 'x1_1'") {
+		t.Errorf("branch of g2 is not committed: %s", dbs[1].log())
+	}
+}
@@ -7,13 +7,13 @@
 package shorm
 
 import (
-	"encoding/json"
+	"database/sql"
 	"encoding/xml"
-	"fmt"
 	"log"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 var sqlGenDict = map[string]SqlGenerator{
@@ -33,14 +33,24 @@ func (e *emptyLogger) Write(b []byte) (n int, err error) {
 
 //Engine provides the entry point to interact with database
 type Engine struct {
-	cluster *Cluster
-	Logger  *log.Logger
-	pool    *sync.Pool
-	driver  string
+	cluster           *Cluster
+	clusterLock       sync.RWMutex
+	reloadLock        sync.Mutex //serializes Reload
+	watchStop         chan struct{}
+	configErr         error //problems of cluster configuration, returned by Open
+	transLog          TransLog
+	transRetries      int
+	transBackoff      time.Duration
+	Logger            *log.Logger
+	pool              *sync.Pool
+	driver            string
+	consistencyWindow time.Duration
+	broadcastTables   map[string]bool //tables replicated to all groups, can be joined across groups
 }
 
 //NewEngine will create *Engine type according to specified driver and cluster,
 //it is recommended to maintain one instance for Engine type.
+//The cluster is validated by Cluster.Validate, problems are returned by Engine.Open.
 /*
 	driver provided by third package, for example: mysql, mymysql, mssql etc... .
 	cluster is the relation database cluster includes one or more db groups.
@@ -51,8 +61,13 @@ func NewEngine(driver string, cluster *Cluster) *Engine {
 		pool:    &sync.Pool{},
 		driver:  driver,
 		Logger:  log.New(&emptyLogger{}, "", 0),
+
+		consistencyWindow: DefaultConsistencyWindow,
+		transRetries:      3,
+		transBackoff:      time.Millisecond * 50,
 	}
 	e.cluster.RealGroups = len(e.cluster.Groups)
+	e.configErr = cluster.Validate()
 	e.pool.New = func() interface{} { return &Session{} }
 	return e
 }
@@ -72,23 +87,28 @@ func NewEngineV2(driver, connstr string) *Engine {
 }
 
 type clusterConfig struct {
-	XMLName xml.Name `json:"-" xml:"ClusterConfig"`
-	Driver  string   `json:"driver"`
-	Cluster *Cluster `json:"cluster"`
+	XMLName xml.Name `json:"-" xml:"ClusterConfig" yaml:"-" toml:"-"`
+	Driver  string   `json:"driver" yaml:"driver" toml:"driver"`
+	Cluster *Cluster `json:"cluster" yaml:"cluster" toml:"cluster"`
 }
 
 // NewEngineFromConfig allows Engine can be created from config file.
-// Currently, the config file could be xml or json file.
+// The config file could be json, xml, yaml(.yaml or .yml) or toml file.
+// ${ENV_VAR} in driver, names and connection strings is replaced with the environment variable,
+// ${file:/path/to/secret} is replaced with the content of the file.
 /*
 	json config:
 	{
 	  "driver": "mssql",
 	  "cluster": {
 	    "total_groups": 10,
+	    "max_open_conns": 100,
+	    "max_idle_conns": 10,
+	    "conn_max_lifetime": "30m",
 	    "groups": [
 	      {
 	        "range_from": 0,
-	        "range_to": 4,
+	        "range_to": 5,
 	        "is_default": true,
 	        "name": "group1",
 	        "nodes": [
@@ -101,13 +121,15 @@ type clusterConfig struct {
 	            "name": "g1_node1",
 	            "conn_string": "server=localhost;database=Test;user id=user;password=pwd",
 	            "node_type": "slave",
-	            "weight": 2
+	            "weight": 2,
+	            "max_open_conns": 200,
+	            "conn_max_idle_time": "5m"
 	          }
 	        ]
 	      },
 	      {
 	        "range_from": 5,
-	        "range_to": 9,
+	        "range_to": 10,
 	        "name": "group2",
 	        "nodes": [
 	          {
@@ -135,8 +157,9 @@ type clusterConfig struct {
 			<Groups>
 				<Group>
 					<Name>group1</Name>
+					<IsDefault>true</IsDefault>
 					<RangeFrom>0</RangeFrom>
-					<RangeTo>4</RangeTo>
+					<RangeTo>5</RangeTo>
 					<Nodes>
 						<Node>
 							<Name>g1_master</Name>
@@ -152,9 +175,9 @@ type clusterConfig struct {
 					</Nodes>
 				</Group>
 				<Group>
-					<Name>group1</Name>
+					<Name>group2</Name>
 					<RangeFrom>5</RangeFrom>
-					<RangeTo>9</RangeTo>
+					<RangeTo>10</RangeTo>
 					<Nodes>
 						<Node>
 							<Name>g2_master</Name>
@@ -174,31 +197,18 @@ type clusterConfig struct {
 	</ClusterConfig>
 */
 func NewEngineFromConfig(config string) (*Engine, error) {
-	var cluster clusterConfig
-	file, err := os.Open(config)
+	cluster, err := loadClusterConfig(config)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	config = strings.ToLower(config)
-	if strings.HasSuffix(config, ".json") {
-		d := json.NewDecoder(file)
-		if err = d.Decode(&cluster); err != nil {
-			return nil, err
-		}
-	} else if strings.HasSuffix(config, ".xml") {
-		d := xml.NewDecoder(file)
-		if err = d.Decode(&cluster); err != nil {
-			return nil, err
-		}
-	} else {
-		return nil, fmt.Errorf("the file format of config file is not be supported.")
+	if err = cluster.Cluster.Validate(); err != nil {
+		return nil, err
 	}
 	return NewEngine(cluster.Driver, cluster.Cluster), nil
 }
 
-//Current the framework only supports single database transaction,
-//doesn't support distribute database trasnaction.
+//BeginTrans begins single database transaction on the group located by shardValue,
+//use BeginDistributedTrans for transaction across groups.
 //Db transaction only will happen on master node.
 /*
 	Usage:
@@ -214,7 +224,16 @@ func NewEngineFromConfig(config string) (*Engine, error) {
 	trans.Commit()
 */
 func (e *Engine) BeginTrans(shardValue int64) (*DbTrans, error) {
-	return newDbTrans(e, shardValue)
+	return newDbTrans(e, shardValue, nil)
+}
+
+// BeginTransWithOptions begins db transaction with options, such as isolation level and read-only
+/*
+	Usage:
+	trans, err := engine.BeginTransWithOptions(shardValue, &sql.TxOptions{Isolation: sql.LevelSerializable})
+*/
+func (e *Engine) BeginTransWithOptions(shardValue int64, opts *sql.TxOptions) (*DbTrans, error) {
+	return newDbTrans(e, shardValue, opts)
 }
 
 //When executing non-transaction sql query, call StartSession to create db session to execute sql operation.
@@ -231,6 +250,10 @@ func (e *Engine) BeginTrans(shardValue int64) (*DbTrans, error) {
 */
 func (e *Engine) StartSession() *Session {
 	s := e.pool.Get().(*Session)
+	e.clusterLock.RLock()
+	s.cluster = e.cluster
+	s.cluster.acquire()
+	e.clusterLock.RUnlock()
 	s.logger = e.Logger
 	s.sqlGen = sqlGenDict[e.driver]
 	s.engine = e
@@ -239,18 +262,35 @@ func (e *Engine) StartSession() *Session {
 
 // After sql query done, call EndSession to put session back into object pool.
 func (e *Engine) EndSession(s *Session) {
+	if s.cluster == nil {
+		//session has been ended
+		return
+	}
 	s.reset()
+	s.written = nil
+	s.cluster.release()
+	s.cluster = nil
 	e.pool.Put(s)
 }
 
 // Open will open all database nodes in cluster
 func (e *Engine) Open() error {
-	return e.cluster.Open(e.driver)
+	if e.configErr != nil {
+		return e.configErr
+	}
+	return e.getCluster().Open(e.driver)
 }
 
 // Close will close all database nodes in cluster
 func (e *Engine) Close() error {
-	return e.cluster.Close()
+	e.StopWatch()
+	return e.getCluster().Close()
+}
+
+func (e *Engine) getCluster() *Cluster {
+	e.clusterLock.RLock()
+	defer e.clusterLock.RUnlock()
+	return e.cluster
 }
 
 // EnableDebug will make framwork running on debug model
@@ -360,6 +400,9 @@ func (e *Engine) Delete(pk, model interface{}) (int64, error) {
 
 // GetTableName 获取实体对应的数据表名称
 func GetTableName(model interface{}) string {
-	meta, _ := getTableMeta(model)
+	meta, err := getTableMeta(model)
+	if err != nil {
+		return ""
+	}
 	return meta.Name
 }
@@ -0,0 +1,147 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Error values returned by shorm, compatible with errors.Is and errors.As
+
+package shorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrNoDefaultGroup is returned when operation falls back to default group which is not specified
+	ErrNoDefaultGroup = errors.New("default db group is not specified")
+	// ErrNoMaster is returned when db group has no master node, wrapped by ShardError
+	ErrNoMaster = errors.New("no master node")
+	// ErrTableScan is returned when query has neither condition nor limit, raw query is not checked
+	ErrTableScan = errors.New("table scan, DANGEROUS!")
+	// ErrNoCondition is returned when UPDATE or DELETE statement has no condition
+	ErrNoCondition = errors.New("statement has no condition, DANGEROUS!")
+	// ErrNoRowsAffected is returned when update in transaction affects no rows
+	ErrNoRowsAffected = errors.New("no rows affected")
+	// ErrUnknownColumn is returned when condition refers to column not mapped by model
+	ErrUnknownColumn = errors.New("unknown column")
+	// ErrCrossShardJoin is returned when joined table may be on other group when querying all groups
+	ErrCrossShardJoin = errors.New("join across shards")
+	// ErrLockLost is returned by Renew or Release when the lease expired and the lock was acquired by others
+	ErrLockLost = errors.New("lock lost")
+)
+
+// ShardError is the error occurred on db group or node
+/*
+	Usage:
+		var shardErr *shorm.ShardError
+		if errors.As(err, &shardErr) {
+			log.Printf("group %s node %s failed", shardErr.Group, shardErr.Node)
+		}
+		if errors.Is(err, shorm.ErrNoMaster) {
+			...
+		}
+*/
+type ShardError struct {
+	Group string
+	Node  string //empty if error is not related to node
+	Err   error
+}
+
+func (e *ShardError) Error() string {
+	if e.Node == "" {
+		return fmt.Sprintf("Group: %s, error:%v", e.Group, e.Err)
+	}
+	return fmt.Sprintf("Group: %s, Node: %s, error:%v", e.Group, e.Node, e.Err)
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+// ShardErrors is the errors occurred on multiple groups when executing sql against all groups
+type ShardErrors []*ShardError
+
+func (e ShardErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, ";")
+}
+
+// Unwrap returns errors of groups, errors.Is and errors.As check each of them
+func (e ShardErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+//Converts error occurred on group to ShardError
+func toShardError(err error) *ShardError {
+	var shardErr *ShardError
+	if errors.As(err, &shardErr) {
+		return shardErr
+	}
+	return &ShardError{Err: err}
+}
+
+//Gets error number of driver error in chain of err, drivers expose it as struct field,
+//such as mysql.MySQLError.Number and mssql.Error.Number
+func driverErrorNumber(err error) (int64, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		value := reflect.Indirect(reflect.ValueOf(err))
+		if value.Kind() != reflect.Struct {
+			continue
+		}
+		switch number := value.FieldByName("Number"); number.Kind() {
+		case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+			return number.Int(), true
+		case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(number.Uint()), true
+		}
+	}
+	return 0, false
+}
+
+//Gets SQLSTATE of driver error in chain of err, such as pq.Error.Code and pgconn.PgError.SQLState()
+func driverErrorState(err error) (string, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if e, ok := err.(interface{ SQLState() string }); ok {
+			return e.SQLState(), true
+		}
+		value := reflect.Indirect(reflect.ValueOf(err))
+		if value.Kind() != reflect.Struct {
+			continue
+		}
+		if code := value.FieldByName("Code"); code.Kind() == reflect.String {
+			return code.String(), true
+		}
+	}
+	return "", false
+}
+
+//Reports whether err is violation of primary key or unique constraint:
+//MySQL 1062, SQL Server 2627 and 2601, Postgres 23505, SQLite 1555 and 2067
+func isDuplicateKeyError(err error) bool {
+	if number, ok := driverErrorNumber(err); ok && (number == 1062 || number == 2627 || number == 2601) {
+		return true
+	}
+	if state, ok := driverErrorState(err); ok && state == "23505" {
+		return true
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		value := reflect.Indirect(reflect.ValueOf(err))
+		if value.Kind() != reflect.Struct {
+			continue
+		}
+		//sqlite3.Error.ExtendedCode
+		if code := value.FieldByName("ExtendedCode"); code.Kind() == reflect.Int {
+			return code.Int() == 1555 || code.Int() == 2067
+		}
+	}
+	return false
+}
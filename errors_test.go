@@ -0,0 +1,94 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRoutingErrors(t *testing.T) {
+	cluster := &Cluster{TotalGroups: 10, Groups: []*DbGroup{
+		{Name: "group1", RangeFrom: 0, RangeTo: 5, Nodes: []*DbNode{{Name: "n1", Type: NodeType_Slave}, {Name: "n2", Type: NodeType_Slave}}},
+		{Name: "group2", RangeFrom: 5, RangeTo: 10},
+	}}
+	if _, err := cluster.DefaultGroup(); err != ErrNoDefaultGroup {
+		t.Errorf("DefaultGroup() error = %v, want ErrNoDefaultGroup", err)
+	}
+	_, err := cluster.Groups[0].GetMaster()
+	if !errors.Is(err, ErrNoMaster) {
+		t.Fatalf("GetMaster() error = %v, want ErrNoMaster", err)
+	}
+	var shardErr *ShardError
+	if !errors.As(err, &shardErr) || shardErr.Group != "group1" {
+		t.Errorf("GetMaster() error = %#v, want ShardError of group1", err)
+	}
+}
+
+func TestShardErrors(t *testing.T) {
+	cause := errors.New("connection refused")
+	var err error = ShardErrors{
+		{Group: "group1", Node: "n1", Err: cause},
+		{Group: "group2", Err: ErrNoMaster},
+	}
+	if want := "Group: group1, Node: n1, error:connection refused;Group: group2, error:no master node"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !errors.Is(err, cause) || !errors.Is(err, ErrNoMaster) {
+		t.Errorf("errors.Is does not match errors of groups")
+	}
+	var shardErr *ShardError
+	if !errors.As(err, &shardErr) || shardErr.Node != "n1" {
+		t.Errorf("errors.As = %#v, want ShardError of node n1", shardErr)
+	}
+}
+
+func TestShardQueryErrors(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	cause := errors.New("connection refused")
+	dbs[0].query = func(sqlStr string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if strings.Contains(sqlStr, "count(1)") {
+			return []string{"count"}, [][]driver.Value{{int64(2)}}, nil
+		}
+		if strings.HasPrefix(sqlStr, "select UserId from") {
+			return []string{"UserId"}, [][]driver.Value{{int64(1)}}, nil
+		}
+		return []string{"UserId", "UserName"}, [][]driver.Value{{int64(1), "a"}}, nil
+	}
+	dbs[1].query = func(string, []driver.Value) ([]string, [][]driver.Value, error) { return nil, nil, cause }
+	for name, query := range map[string]func(s *Session) error{
+		"Find": func(s *Session) error {
+			var users []*genUser
+			return s.Where("Age>?", 18).Find(&users)
+		},
+		"Count": func(s *Session) error { _, err := s.Count(&genUser{}); return err },
+		"FindMaps": func(s *Session) error {
+			var maps []map[string]interface{}
+			return s.Query("select UserId, UserName from T_User").FindMaps(&maps)
+		},
+		"FindValues": func(s *Session) error {
+			var ids []int64
+			return s.Query("select UserId from T_User").FindValues(&ids)
+		},
+	} {
+		s := engine.StartSession()
+		err := query(s)
+		engine.EndSession(s)
+		var shardErr *ShardError
+		if !errors.Is(err, cause) || !errors.As(err, &shardErr) || shardErr.Group != "g2" {
+			t.Errorf("%s() error = %v, want error of g2", name, err)
+		}
+	}
+
+	//no group returns row
+	dbs[0].query = nil
+	s := engine.StartSession()
+	defer engine.EndSession(s)
+	if _, err := s.Where("UserName=?", "a").Get(&genUser{}); !errors.Is(err, cause) {
+		t.Errorf("Get() error = %v, want error of g2", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//Fake driver recording statements, results are produced by handlers of fakeDb
+type fakeDriver struct{}
+
+var (
+	fakeDbs      sync.Map //dsn -> *fakeDb
+	fakeDbSeq    int64
+	registerFake sync.Once
+)
+
+type fakeDb struct {
+	lock  sync.Mutex
+	stmts []string //executed sql, begin, commit and rollback included
+	//returns columns and rows of query, no rows by default
+	query func(sqlStr string, args []driver.Value) ([]string, [][]driver.Value, error)
+	//returns affected rows of exec, 1 by default
+	exec func(sqlStr string, args []driver.Value) (int64, error)
+}
+
+//Creates fake db and the sql.DB connected to it
+func newFakeDb() (*fakeDb, *sql.DB) {
+	f, db, _ := openFakeDb()
+	return f, db
+}
+
+func openFakeDb() (*fakeDb, *sql.DB, string) {
+	registerFake.Do(func() { sql.Register("shorm_fake", fakeDriver{}) })
+	f := &fakeDb{}
+	dsn := fmt.Sprintf("fake%d", atomic.AddInt64(&fakeDbSeq, 1))
+	fakeDbs.Store(dsn, f)
+	db, _ := sql.Open("shorm_fake", dsn)
+	return f, db, dsn
+}
+
+//Creates engine of one group whose master is fake db
+func newFakeEngine(driver string) (*Engine, *fakeDb) {
+	f, db, dsn := openFakeDb()
+	cluster := &Cluster{TotalGroups: 1, Groups: []*DbGroup{
+		{Name: "g1", RangeFrom: 0, RangeTo: 1, Nodes: []*DbNode{{Name: "master", ConnStr: dsn, Type: NodeType_Master, Db: db}}},
+	}}
+	return NewEngine(driver, cluster), f
+}
+
+func (f *fakeDb) record(sqlStr string) {
+	f.lock.Lock()
+	f.stmts = append(f.stmts, sqlStr)
+	f.lock.Unlock()
+}
+
+//Returns executed statements joined by ;
+func (f *fakeDb) log() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return strings.Join(f.stmts, ";")
+}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	f, ok := fakeDbs.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("fake db %s not found", dsn)
+	}
+	return &fakeConn{db: f.(*fakeDb)}, nil
+}
+
+type fakeConn struct{ db *fakeDb }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.record("begin")
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Begin()
+}
+
+func (c *fakeConn) exec(query string, args []driver.Value) (driver.Result, error) {
+	c.db.record(query)
+	if c.db.exec == nil {
+		return driver.RowsAffected(1), nil
+	}
+	n, err := c.db.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (c *fakeConn) query(query string, args []driver.Value) (driver.Rows, error) {
+	c.db.record(query)
+	if c.db.query == nil {
+		return &fakeRows{}, nil
+	}
+	cols, rows, err := c.db.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{cols: cols, rows: rows}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.exec(query, namedValues(args))
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.query(query, namedValues(args))
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.exec(s.query, args)
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.query(s.query, args)
+}
+
+type fakeTx struct{ db *fakeDb }
+
+func (t *fakeTx) Commit() error   { t.db.record("commit"); return nil }
+func (t *fakeTx) Rollback() error { t.db.record("rollback"); return nil }
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Joins between co-located tables
+
+package shorm
+
+import (
+	"fmt"
+	"strings"
+)
+
+type sqlJoin struct {
+	kind  string //join or left join
+	table string
+	alias string
+}
+
+func newJoinClause(kind, table, alias, on string, args []interface{}) sqlClause {
+	return sqlClause{
+		op:     opType_join,
+		clause: on,
+		params: args,
+		join:   &sqlJoin{kind: kind, table: table, alias: alias},
+	}
+}
+
+// Alias specifies alias of the queried table, used to qualify columns when joining tables
+func (s SqlWhere) Alias(alias string) SqlWhere {
+	return append(s, sqlClause{op: opType_alias, clause: alias})
+}
+
+// Join equals < join table alias on condition >
+func (s SqlWhere) Join(table, alias, on string, args ...interface{}) SqlWhere {
+	return append(s, newJoinClause("join", table, alias, on, args))
+}
+
+// LeftJoin equals < left join table alias on condition >
+func (s SqlWhere) LeftJoin(table, alias, on string, args ...interface{}) SqlWhere {
+	return append(s, newJoinClause("left join", table, alias, on, args))
+}
+
+// Alias specifies alias of the queried table, used to qualify columns when joining tables
+func (s *Session) Alias(alias string) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_alias, clause: alias})
+	return s
+}
+
+// Join equals < join table alias on condition >.
+// Selected columns are mapped into composite struct embedding models with 'extends' tag,
+// the first embedded model is the main table, columns are qualified by alias of their tables,
+// column with the same name as column of former table is selected as Table__Column.
+// Without shard value, the query is executed on all groups, so joined tables must be broadcast tables
+// or sharded by the same key whose equality is an and term of on condition, otherwise ErrCrossShardJoin is returned.
+/*
+	Usage:
+		type OrderUser struct {
+			Order `shorm:"extends"`
+			User  `shorm:"extends"`
+		}
+		var list []*OrderUser
+		err := session.Alias("o").Join("T_User", "u", "u.UserId=o.UserId").
+			Where("o.CreatedTime>?", from).Find(&list)
+*/
+func (s *Session) Join(table, alias, on string, args ...interface{}) *Session {
+	s.clauseList = append(s.clauseList, newJoinClause("join", table, alias, on, args))
+	return s
+}
+
+// LeftJoin equals < left join table alias on condition >, see Join
+func (s *Session) LeftJoin(table, alias, on string, args ...interface{}) *Session {
+	s.clauseList = append(s.clauseList, newJoinClause("left join", table, alias, on, args))
+	return s
+}
+
+// BroadcastTables registers tables replicated to all groups, which can be joined when querying all groups.
+// It should be called before executing queries.
+func (e *Engine) BroadcastTables(names ...string) {
+	if e.broadcastTables == nil {
+		e.broadcastTables = make(map[string]bool)
+	}
+	for _, name := range names {
+		e.broadcastTables[strings.ToLower(name)] = true
+	}
+}
+
+//Metadata of extends struct mapped to table
+func (t *TableMetadata) extendTable(name string) *TableMetadata {
+	for _, ext := range t.extends {
+		if strings.EqualFold(ext.Name, name) {
+			return ext
+		}
+	}
+	return nil
+}
+
+//Removes quotes and spaces of sql for comparing
+func normalizeSql(sql string) string {
+	return strings.ToLower(strings.NewReplacer("`", "", "[", "", "]", "", `"`, "", " ", "", "\t", "", "\r", "", "\n", "").Replace(sql))
+}
+
+//Splits condition by and out of parentheses and literals
+func splitAnd(cond string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i := 0; i < len(cond); i++ {
+		switch {
+		case isLiteralStart(cond, i):
+			i = skipLiteral(cond, i) - 1
+		case cond[i] == '(':
+			depth++
+		case cond[i] == ')':
+			depth--
+		case depth == 0 && isKeywordAt(cond, i, "and"):
+			terms = append(terms, cond[start:i])
+			start = i + 3
+			i += 2
+		}
+	}
+	return append(terms, cond[start:])
+}
+
+//Reports whether keyword is at i of s as a whole word
+func isKeywordAt(s string, i int, keyword string) bool {
+	end := i + len(keyword)
+	if end > len(s) || !strings.EqualFold(s[i:end], keyword) {
+		return false
+	}
+	return (i == 0 || !isWordChar(s[i-1])) && (end == len(s) || !isWordChar(s[end]))
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '[' || c == ']' || c == '$' ||
+		c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+//Reports whether condition requires left=right, which is a term of and out of parentheses
+func hasEqualTerm(cond, left, right string) bool {
+	for _, term := range splitAnd(cond) {
+		term = normalizeSql(term)
+		for strings.HasPrefix(term, "(") && strings.HasSuffix(term, ")") && len(splitAnd(term[1:len(term)-1])) == 1 {
+			term = term[1 : len(term)-1]
+		}
+		if term == left+"="+right || term == right+"="+left {
+			return true
+		}
+	}
+	return false
+}
+
+//Checks if joined tables are on the same group when querying all groups
+func (s *Session) checkJoin(table *TableMetadata) error {
+	mainName := table.Name
+	for _, c := range s.clauseList {
+		if c.op == opType_alias {
+			mainName = c.clause
+		}
+	}
+	for _, c := range s.clauseList {
+		if c.op != opType_join || s.engine.broadcastTables[strings.ToLower(c.join.table)] {
+			continue
+		}
+		ext := table.extendTable(c.join.table)
+		if table.ShardColumn != nil && ext != nil && ext.ShardColumn != nil {
+			joinName := c.join.alias
+			if joinName == "" {
+				joinName = c.join.table
+			}
+			left := normalizeSql(mainName + "." + table.ShardColumn.name)
+			right := normalizeSql(joinName + "." + ext.ShardColumn.name)
+			if hasEqualTerm(c.clause, left, right) {
+				continue
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrCrossShardJoin, c.join.table)
+	}
+	return nil
+}
+
+//Generates join clause
+func (m *BaseGenerator) genJoin(s sqlClause) string {
+	name := wrapName(s.join.table, m.wrapColumn)
+	if s.join.alias != "" {
+		name += " " + s.join.alias
+	}
+	return fmt.Sprintf(" %s %s on %s", s.join.kind, name, s.clause)
+}
+
+//Generates column of select list, column sharing name with other joined table is renamed by alias
+func (m *BaseGenerator) selectColumn(qualifier string, col *columnMetadata) string {
+	if col.alias != "" {
+		return qualifier + m.wrapColumn(col.name) + " as " + m.wrapColumn(col.alias)
+	}
+	return qualifier + m.wrapColumn(col.name)
+}
+
+//Gets qualifier of column, which is alias or name of its table followed by dot.
+//Columns are not qualified if no table joined.
+func (m *BaseGenerator) columnQualifier(table *TableMetadata, sqls sqlClauseList) func(col *columnMetadata) string {
+	var main, alias string
+	joins := make(map[string]string)
+	for _, s := range sqls {
+		switch s.op {
+		case opType_table:
+			if main == "" {
+				main = s.clause
+			}
+		case opType_alias:
+			alias = s.clause
+		case opType_join:
+			name := s.join.alias
+			if name == "" {
+				name = wrapName(s.join.table, m.wrapColumn)
+			}
+			joins[strings.ToLower(s.join.table)] = name + "."
+		}
+	}
+	if len(joins) <= 0 {
+		return func(col *columnMetadata) string { return "" }
+	}
+	if alias != "" {
+		main = alias
+	} else if main == "" {
+		main = m.wrapColumn(table.Name)
+	}
+	main += "."
+	return func(col *columnMetadata) string {
+		if col.table == "" || strings.EqualFold(col.table, table.Name) {
+			return main
+		}
+		return joins[strings.ToLower(col.table)]
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+type joinOrder struct {
+	TabName TableName `shorm:"T_Order"`
+	Id      int64     `shorm:",pk"`
+	UserId  int64     `shorm:",shard"`
+	Amount  float64
+}
+
+type joinOrderUser struct {
+	joinOrder `shorm:"extends"`
+	genUser   `shorm:"extends"`
+}
+
+func TestGenSelectJoin(t *testing.T) {
+	table, err := getTableMeta(joinOrderUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Name != "T_Order" || table.IdColumn.name != "Id" || table.ShardColumn.name != "UserId" {
+		t.Fatalf("unexpected main table %s, id %s, shard %s", table.Name, table.IdColumn.name, table.ShardColumn.name)
+	}
+	cases := []genCase{
+		{
+			name: "base join with alias",
+			gen:  newBaseGenerator(),
+			sqls: sqlClauseList(W().Alias("o").Join("T_User", "u", "u.UserId=o.UserId and u.Age>?", 18).Where("o.Amount>?", 10)),
+			sql:  "select u.`Age`,o.`Amount`,o.`Id`,u.`UserId` as `T_User__UserId`,o.`UserId`,u.`UserName` from `T_Order` o join `T_User` u on u.UserId=o.UserId and u.Age>? where o.Amount>?",
+			args: []interface{}{18, 10},
+		},
+		{
+			name: "mssql left join without alias",
+			gen:  NewMSSqlGenerator(),
+			sqls: sqlClauseList{{op: opType_id, params: []interface{}{1}}, newJoinClause("left join", "T_User", "", "[T_User].UserId=[T_Order].UserId", nil)},
+			sql:  "select [T_User].[Age],[T_Order].[Amount],[T_Order].[Id],[T_User].[UserId] as [T_User__UserId],[T_Order].[UserId],[T_User].[UserName] from [T_Order] left join [T_User] on [T_User].UserId=[T_Order].UserId where [T_Order].Id=?",
+			args: []interface{}{1},
+		},
+	}
+	for _, c := range cases {
+		sql, args := c.gen.GenSelect(table, c.sqls)
+		if sql != c.sql {
+			t.Errorf("%s:\n\texpected %s\n\tbut      %s", c.name, c.sql, sql)
+		}
+		if len(args) != len(c.args) {
+			t.Errorf("%s: expected args %v, but %v", c.name, c.args, args)
+		}
+	}
+}
+
+func TestCheckJoin(t *testing.T) {
+	table, err := getTableMeta(joinOrderUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := &Engine{}
+	engine.BroadcastTables("T_Region")
+	cases := []struct {
+		name  string
+		where SqlWhere
+		err   error
+	}{
+		{"shared shard key", W().Alias("o").Join("T_User", "u", "o.UserId = u.UserId"), nil},
+		{"shared shard key quoted", W().Join("T_User", "", "`T_User`.`UserId`=`T_Order`.`UserId` and 1=1"), nil},
+		{"broadcast table", W().LeftJoin("T_Region", "r", "r.Id=o.RegionId"), nil},
+		{"parenthesized term", W().Alias("o").Join("T_User", "u", "u.Age>? AND\n(o.UserId=u.UserId)", 18), nil},
+		{"other column", W().Alias("o").Join("T_User", "u", "u.UserId=o.Id"), ErrCrossShardJoin},
+		{"column of longer name", W().Alias("o").Join("T_User", "u", "o.UserId=u.UserIdX"), ErrCrossShardJoin},
+		{"or term", W().Alias("o").Join("T_User", "u", "o.UserId=u.UserId or 1=1"), ErrCrossShardJoin},
+		{"nested in or", W().Alias("o").Join("T_User", "u", "(o.UserId=u.UserId or 1=1) and u.Age>0"), ErrCrossShardJoin},
+		{"quoted and", W().Alias("o").Join("T_User", "u", "u.UserName='a and o.UserId=u.UserId'"), ErrCrossShardJoin},
+		{"not extends", W().Join("T_Item", "i", "i.UserId=o.UserId"), ErrCrossShardJoin},
+	}
+	for _, c := range cases {
+		s := &Session{engine: engine, clauseList: sqlClauseList(c.where)}
+		if err := s.checkJoin(table); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected error %v, but %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestFindJoinSharedColumns(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	db.query = func(sqlStr string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return []string{"Age", "Amount", "Id", "T_User__UserId", "UserId", "UserName"},
+			[][]driver.Value{{int64(18), 9.5, int64(1), int64(7), int64(8), "sz"}}, nil
+	}
+	s := engine.StartSession()
+	defer engine.EndSession(s)
+	var list []*joinOrderUser
+	if err := s.Alias("o").Join("T_User", "u", "u.UserId=o.UserId").Where("o.Amount>?", 1).Find(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].joinOrder.UserId != 8 || list[0].genUser.Id != 7 || list[0].UserName != "sz" {
+		t.Errorf("Find() = %+v, want UserId of T_Order 8 and T_User 7", list[0])
+	}
+}
+
+type baseModel struct {
+	Id      int64 `shorm:",pk"`
+	Created int64
+}
+
+//Model sharing columns of mixin
+type mixinUser struct {
+	TabName   TableName `shorm:"T_User"`
+	baseModel `shorm:"extends"`
+	UserId    int64 `shorm:",shard"`
+	Created   int64
+}
+
+type mixinOrder struct {
+	TabName   TableName `shorm:"T_Order"`
+	baseModel `shorm:"extends"`
+	UserId    int64 `shorm:",shard"`
+}
+
+type joinMixin struct {
+	mixinOrder `shorm:"extends"`
+	mixinUser  `shorm:"extends"`
+}
+
+func TestMixinColumns(t *testing.T) {
+	table, err := getTableMeta(mixinUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql, _ := newBaseGenerator().GenSelect(table, nil); sql != "select `Created`,`Id`,`UserId` from `T_User`" {
+		t.Errorf("columns of mixin are not columns of model: %s", sql)
+	}
+	if len(table.extends) != 0 {
+		t.Errorf("mixin is regarded as joined table")
+	}
+
+	table, err = getTableMeta(joinMixin{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _ := newBaseGenerator().GenSelect(table, sqlClauseList(W().Alias("o").Join("T_User", "u", "u.UserId=o.UserId")))
+	want := "select o.`Created`,o.`Id`,u.`Created` as `T_User__Created`,u.`Id` as `T_User__Id`,u.`UserId` as `T_User__UserId`,o.`UserId` " +
+		"from `T_Order` o join `T_User` u on u.UserId=o.UserId"
+	if sql != want {
+		t.Errorf("mixin columns of joined tables:\n\texpected %s\n\tbut      %s", want, sql)
+	}
+}
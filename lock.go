@@ -0,0 +1,260 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Database-backed distributed lock
+
+package shorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+)
+
+// LockRecord is the row of lock table on master node of default group.
+/*
+	create table shorm_lock(
+		LockName varchar(200) not null primary key,
+		Owner varchar(200) not null,
+		Token bigint not null,
+		ExpireTime datetime not null
+	)
+*/
+type LockRecord struct {
+	TabName    TableName `shorm:"shorm_lock"`
+	LockName   string    `shorm:",pk,notnull"`
+	Owner      string    `shorm:",notnull"`
+	Token      int64     `shorm:",notnull"` //fencing token, increased every time the lock is acquired
+	ExpireTime time.Time
+}
+
+// LockRetryInterval is the interval to retry acquiring lock held by others
+var LockRetryInterval = time.Millisecond * 200
+
+// Lease is the ownership of distributed lock
+type Lease struct {
+	engine *Engine
+	group  *DbGroup //group of lock table, nil for default group
+	Name   string
+	Owner  string
+	// Token is the fencing token which is increased every time the lock is acquired,
+	// pass it to the protected resource to reject requests from stale owners. It is 0 for advisory lock.
+	Token int64
+	ttl   time.Duration
+	//used by advisory lock
+	conn    *sql.Conn
+	release string
+	args    []interface{}
+}
+
+func newLockOwner() string {
+	host, _ := os.Hostname()
+	id, _ := newXid()
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), id)
+}
+
+// Lock acquires the lock backed by lock table, waits until acquired or ctx done.
+// The lease expires after ttl if not renewed, expiration is judged by clock of application servers.
+/*
+	Usage:
+		lease, err := engine.Lock(ctx, "daily-report", time.Minute)
+		if err != nil {
+			return err
+		}
+		defer lease.Release(ctx)
+		...
+		if err = lease.Renew(ctx); err == shorm.ErrLockLost {
+			return err
+		}
+*/
+func (e *Engine) Lock(ctx context.Context, name string, ttl time.Duration) (*Lease, error) {
+	lease := &Lease{engine: e, Name: name, Owner: newLockOwner(), ttl: ttl}
+	for {
+		acquired, err := lease.tryAcquire()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return lease, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
+
+func (l *Lease) session() (*Session, error) {
+	group := l.group
+	if group == nil {
+		var err error
+		if group, err = l.engine.getCluster().DefaultGroup(); err != nil {
+			return nil, err
+		}
+	}
+	s := l.engine.StartSession()
+	return s.onGroup(group).ForseMaster(), nil
+}
+
+func (l *Lease) tryAcquire() (bool, error) {
+	s, err := l.session()
+	if err != nil {
+		return false, err
+	}
+	defer l.engine.EndSession(s)
+	group := s.group
+	var record LockRecord
+	has, err := s.Id(l.Name).Get(&record)
+	if err == sql.ErrNoRows {
+		has, err = false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if !has {
+		record = LockRecord{LockName: l.Name, Owner: l.Owner, Token: 1, ExpireTime: now.Add(l.ttl)}
+		if _, err = s.onGroup(group).Insert(&record); err != nil {
+			//the lock may be created by others at the same time, retry later
+			if isDuplicateKeyError(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		l.Token = record.Token
+		return true, nil
+	}
+	if record.ExpireTime.After(now) {
+		return false, nil
+	}
+	oldToken := record.Token
+	record.Owner = l.Owner
+	record.Token = oldToken + 1
+	record.ExpireTime = now.Add(l.ttl)
+	n, err := s.onGroup(group).Id(l.Name).And("Token=?", oldToken).Cols("Owner,Token,ExpireTime").Update(&record)
+	if err != nil {
+		return false, err
+	}
+	if n <= 0 {
+		return false, nil
+	}
+	l.Token = record.Token
+	return true, nil
+}
+
+func (l *Lease) setExpireTime(expire time.Time) error {
+	s, err := l.session()
+	if err != nil {
+		return err
+	}
+	defer l.engine.EndSession(s)
+	record := LockRecord{ExpireTime: expire}
+	n, err := s.Id(l.Name).And("Owner=?", l.Owner).And("Token=?", l.Token).Cols("ExpireTime").Update(&record)
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Renew extends the lease by ttl, returns ErrLockLost if the lock has been acquired by others.
+// For advisory lock, it checks the connection holding the lock is alive.
+func (l *Lease) Renew(ctx context.Context) error {
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err != nil {
+			return ErrLockLost
+		}
+		return nil
+	}
+	return l.setExpireTime(time.Now().Add(l.ttl))
+}
+
+// Release releases the lock
+func (l *Lease) Release(ctx context.Context) error {
+	if l.conn != nil {
+		defer l.conn.Close()
+		_, err := l.conn.ExecContext(ctx, l.release, l.args...)
+		return err
+	}
+	return l.setExpireTime(time.Now())
+}
+
+//Native advisory lock of database
+type advisoryLock struct {
+	tryLock string //returns 1 if acquired
+	release string
+	args    func(name string) []interface{}
+}
+
+var advisoryLockDict = map[string]advisoryLock{
+	"mysql": {
+		tryLock: "select get_lock(?, 0)",
+		release: "select release_lock(?)",
+		args:    func(name string) []interface{} { return []interface{}{name} },
+	},
+	"postgres": {
+		tryLock: "select case when pg_try_advisory_lock($1) then 1 else 0 end",
+		release: "select pg_advisory_unlock($1)",
+		args: func(name string) []interface{} {
+			h := fnv.New64a()
+			h.Write([]byte(name))
+			return []interface{}{int64(h.Sum64())}
+		},
+	},
+	"mssql": {
+		tryLock: "declare @r int; exec @r = sp_getapplock @Resource=?, @LockMode='Exclusive', @LockOwner='Session', @LockTimeout=0; select case when @r >= 0 then 1 else 0 end",
+		release: "exec sp_releaseapplock @Resource=?, @LockOwner='Session'",
+		args:    func(name string) []interface{} { return []interface{}{name} },
+	},
+}
+
+func init() {
+	advisoryLockDict["mymysql"] = advisoryLockDict["mysql"]
+}
+
+// AdvisoryLock acquires the native advisory lock on master node of default group,
+// GET_LOCK on mysql, pg_advisory_lock on postgres and sp_getapplock on SQL Server.
+// The lock is held by a dedicated connection until released or the connection broken,
+// it has no ttl and no fencing token.
+func (e *Engine) AdvisoryLock(ctx context.Context, name string) (*Lease, error) {
+	dialect, ok := advisoryLockDict[e.driver]
+	if !ok {
+		return nil, fmt.Errorf("advisory lock is not supported by driver %s", e.driver)
+	}
+	group, err := e.getCluster().DefaultGroup()
+	if err != nil {
+		return nil, err
+	}
+	node, err := group.GetMaster()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := node.Db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := dialect.args(name)
+	for {
+		var acquired sql.NullInt64
+		if err = conn.QueryRowContext(ctx, dialect.tryLock, args...).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if acquired.Int64 == 1 {
+			return &Lease{engine: e, Name: name, conn: conn, release: dialect.release, args: args}, nil
+		}
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Fake lock table of one lock, updates are applied only if conditions match
+type fakeLockTable struct {
+	lock sync.Mutex
+	row  map[string]driver.Value
+}
+
+var lockColumnPattern = regexp.MustCompile("`?(\\w+)`?=\\?")
+
+func (l *fakeLockTable) query(sqlStr string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	cols := []string{"LockName", "Owner", "Token", "ExpireTime"}
+	if l.row == nil {
+		return cols, nil, nil
+	}
+	row := make([]driver.Value, len(cols))
+	for i, col := range cols {
+		row[i] = l.row[col]
+	}
+	return cols, [][]driver.Value{row}, nil
+}
+
+func (l *fakeLockTable) exec(sqlStr string, args []driver.Value) (int64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if strings.HasPrefix(sqlStr, "insert") {
+		if l.row != nil {
+			return 0, &fakeNumberError{1062}
+		}
+		cols := strings.Split(sqlStr[strings.Index(sqlStr, "(")+1:strings.Index(sqlStr, ")")], ",")
+		l.row = make(map[string]driver.Value)
+		for i, col := range cols {
+			l.row[strings.Trim(col, "`")] = args[i]
+		}
+		return 1, nil
+	}
+	//update set ... where ..., columns are matched with args in order
+	where := strings.Index(sqlStr, " where ")
+	sets := lockColumnPattern.FindAllStringSubmatch(sqlStr[:where], -1)
+	conds := lockColumnPattern.FindAllStringSubmatch(sqlStr[where:], -1)
+	if l.row == nil {
+		return 0, nil
+	}
+	for i, cond := range conds {
+		if l.row[cond[1]] != args[len(sets)+i] {
+			return 0, nil
+		}
+	}
+	for i, set := range sets {
+		l.row[set[1]] = args[i]
+	}
+	return 1, nil
+}
+
+func (l *fakeLockTable) expire() {
+	l.lock.Lock()
+	l.row["ExpireTime"] = time.Now().Add(-time.Second)
+	l.lock.Unlock()
+}
+
+func TestLockLease(t *testing.T) {
+	interval := LockRetryInterval
+	LockRetryInterval = time.Millisecond
+	defer func() { LockRetryInterval = interval }()
+	engine, db := newFakeEngine("mysql")
+	table := &fakeLockTable{}
+	db.query, db.exec = table.query, table.exec
+
+	ctx := context.Background()
+	first, err := engine.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Token != 1 {
+		t.Errorf("Token = %d, want 1", first.Token)
+	}
+	timeout, cancel := context.WithTimeout(ctx, time.Millisecond*20)
+	defer cancel()
+	if _, err = engine.Lock(timeout, "job", time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("Lock() held by others error = %v, want context.DeadlineExceeded", err)
+	}
+	if err = first.Renew(ctx); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+
+	//the lease expires and the lock is taken over
+	table.expire()
+	second, err := engine.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Token != 2 {
+		t.Errorf("Token of second owner = %d, want 2", second.Token)
+	}
+	if err = first.Renew(ctx); err != ErrLockLost {
+		t.Errorf("Renew() of stale owner error = %v, want ErrLockLost", err)
+	}
+	if err = first.Release(ctx); err != ErrLockLost {
+		t.Errorf("Release() of stale owner error = %v, want ErrLockLost", err)
+	}
+	if err = second.Release(ctx); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+	third, err := engine.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Token != 3 {
+		t.Errorf("Token after release = %d, want 3", third.Token)
+	}
+}
+
+func TestLockError(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	//table shorm_lock does not exist
+	db.exec = func(string, []driver.Value) (int64, error) { return 0, &fakeNumberError{1146} }
+	done := make(chan error, 1)
+	go func() {
+		_, err := engine.Lock(context.Background(), "job", time.Minute)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if number, _ := driverErrorNumber(err); number != 1146 {
+			t.Errorf("Lock() error = %v, want error of insert", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lock() keeps retrying on error other than duplicate key")
+	}
+}
+
+func TestDuplicateKeyError(t *testing.T) {
+	for _, c := range []struct {
+		err error
+		dup bool
+	}{
+		{&fakeNumberError{1062}, true},
+		{&ShardError{Group: "g1", Err: &fakeNumberError{2627}}, true},
+		{&fakeNumberError{1146}, false},
+		{driver.ErrBadConn, false},
+	} {
+		if isDuplicateKeyError(c.err) != c.dup {
+			t.Errorf("isDuplicateKeyError(%v) = %v, want %v", c.err, !c.dup, c.dup)
+		}
+	}
+}
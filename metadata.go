@@ -68,14 +68,47 @@ func extractTableMetadata(structVal reflect.Value) *TableMetadata {
 		IsShardinger: structType.Implements(shardingerType),
 	}
 
-	extractColMetadata(table, structType, nil)
+	extractColMetadata(table, structType, nil, "")
 	if table.Name == "" {
 		table.Name = structType.Name()
 	}
 	return table
 }
 
-func extractColMetadata(table *TableMetadata, structType reflect.Type, parentFieldIndex []int) {
+//Name of table mapped by struct
+func structTableName(structType reflect.Type) string {
+	tableNameType := reflect.TypeOf(new(TableName)).Elem()
+	for i := 0; i < structType.NumField(); i++ {
+		if field := structType.Field(i); field.Type == tableNameType {
+			if name := field.Tag.Get(tag_shorm); name != "" {
+				return name
+			}
+		}
+	}
+	return structType.Name()
+}
+
+//Composite struct for joins consists of extends structs only, each of them is mapped to a joined table.
+//Extends struct of other models is mixin of fields, e.g. shared BaseModel, whose columns belong to the model.
+func isCompositeStruct(structType reflect.Type) bool {
+	tableNameType := reflect.TypeOf(new(TableName)).Elem()
+	extends := 0
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		switch tag := field.Tag.Get(tag_shorm); {
+		case field.Type == tableNameType:
+			return false
+		case tag == tag_extends:
+			extends++
+		case tag != tag_ignore:
+			return false
+		}
+	}
+	return extends > 0
+}
+
+//tableName is the table of extends struct of composite struct, empty for fields of model itself and its mixins
+func extractColMetadata(table *TableMetadata, structType reflect.Type, parentFieldIndex []int, tableName string) {
 	tableNameType := reflect.TypeOf(new(TableName)).Elem()
 	var field reflect.StructField
 	for i := 0; i < structType.NumField(); i++ {
@@ -95,18 +128,32 @@ func extractColMetadata(table *TableMetadata, structType reflect.Type, parentFie
 			if field.Type.Kind() == reflect.Ptr {
 				elementType = field.Type.Elem()
 			}
-			if elementType.Kind() == reflect.Struct {
-				extractColMetadata(table, elementType, field.Index)
+			if elementType.Kind() != reflect.Struct {
+				continue
+			}
+			if tableName == "" && parentFieldIndex == nil && isCompositeStruct(structType) {
+				extractColMetadata(table, elementType, field.Index, structTableName(elementType))
+				table.extends = append(table.extends, extractTableMetadata(reflect.New(elementType).Elem()))
+			} else {
+				index := append(append([]int(nil), parentFieldIndex...), field.Index...)
+				extractColMetadata(table, elementType, index, tableName)
 			}
 			continue
 		}
-		col := &columnMetadata{isNullable: true, parentFieldIndex: parentFieldIndex}
+		col := &columnMetadata{isNullable: true, parentFieldIndex: parentFieldIndex, table: tableName}
 		col.convertFromField(field, tag)
-		table.Columns.Add(strings.ToLower(col.name), col)
-		if col.isKey {
+		key := strings.ToLower(col.name)
+		if _, ok := table.Columns[key]; ok && tableName != "" {
+			//column sharing name with the former joined table is selected as Table__Column
+			col.alias = tableName + "__" + col.name
+			key = strings.ToLower(col.alias)
+		}
+		table.Columns.Add(key, col)
+		//the first extends struct is the main table of composite model
+		if col.isKey && (parentFieldIndex == nil || table.IdColumn == nil) {
 			table.IdColumn = col
 		}
-		if col.isShardKey {
+		if col.isShardKey && (parentFieldIndex == nil || table.ShardColumn == nil) {
 			table.ShardColumn = col
 		}
 	}
@@ -123,6 +170,8 @@ type TableMetadata struct {
 	//ShardColumn is the column as marked with 'shard' in 'shorm' tag, it is used to calculate db group
 	IdColumn, ShardColumn *columnMetadata
 	IsShardinger          bool //Indicates if the type implements interface Shardinger
+
+	extends []*TableMetadata //Tables of structs embedded with 'extends' tag
 }
 
 type ColMetadataMap map[string]*columnMetadata
@@ -144,6 +193,33 @@ func (c ColMetadataMap) Add(k string, v *columnMetadata) {
 	}
 }
 
+//Gets column by name in result set ignoring case
+func (c ColMetadataMap) match(name string) (*columnMetadata, bool) {
+	v, ok := c[strings.ToLower(name)]
+	return v, ok
+}
+
+//Gets column by name in result of raw query, underscores are ignored if not matched,
+//e.g. total_amount matches TotalAmount of ad-hoc struct.
+//Name matching more than one column is ambiguous and matches none.
+func (c ColMetadataMap) matchAdhoc(name string) (*columnMetadata, bool) {
+	if v, ok := c.match(name); ok {
+		return v, true
+	}
+	key := strings.ReplaceAll(strings.ToLower(name), "_", "")
+	var found *columnMetadata
+	for k, v := range c {
+		if strings.ReplaceAll(k, "_", "") != key || v == found {
+			continue
+		}
+		if found != nil {
+			return nil, false
+		}
+		found = v
+	}
+	return found, found != nil
+}
+
 func (c ColMetadataMap) Union(other ColMetadataMap) {
 	for k, v := range other {
 		c.Add(k, v)
@@ -164,6 +240,8 @@ const (
 //data column metadata
 type columnMetadata struct {
 	name                                                   string
+	table                                                  string //table of extends struct, empty if column of model itself
+	alias                                                  string //name in result set if the name is used by other joined table
 	dbType                                                 reflect.Type
 	goType                                                 reflect.Type
 	fieldIndex, parentFieldIndex                           []int
@@ -0,0 +1,205 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Named parameters of raw sql
+
+package shorm
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//Positional placeholders of drivers, ? if not specified
+var placeholderDict = map[string]func(n int) string{
+	"postgres": func(n int) string { return "$" + strconv.Itoa(n) },
+}
+
+func questionPlaceholder(n int) string {
+	return "?"
+}
+
+//Gets the value of named parameter
+type namedLookup func(name string) (interface{}, bool)
+
+//Creates lookup of named parameters from map or struct,
+//fields of struct are matched by column names in shorm tag ignoring case
+func newNamedLookup(arg interface{}, getter valueGetter) (namedLookup, error) {
+	value := reflect.Indirect(reflect.ValueOf(arg))
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("key of named parameters map must be string, but %s", value.Type().Key())
+		}
+		return func(name string) (interface{}, bool) {
+			v := value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+			if !v.IsValid() {
+				return nil, false
+			}
+			return v.Interface(), true
+		}, nil
+	case reflect.Struct:
+		table, err := getTableMeta(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(name string) (interface{}, bool) {
+			col, ok := table.Columns[strings.ToLower(name)]
+			if !ok {
+				return nil, false
+			}
+			return getter.getValue(col, value), true
+		}, nil
+	}
+	return nil, fmt.Errorf("named parameters must be map or struct, but %s", value.Kind())
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || (!first && '0' <= c && c <= '9')
+}
+
+//Checks if quoted literal or comment starts at i
+func isLiteralStart(query string, i int) bool {
+	switch query[i] {
+	case '\'', '"', '`':
+		return true
+	case '-':
+		return strings.HasPrefix(query[i:], "--")
+	case '/':
+		return strings.HasPrefix(query[i:], "/*")
+	}
+	return false
+}
+
+//Index after the end of quoted literal or comment starts at i, len(query) if not closed
+func skipLiteral(query string, i int) int {
+	switch query[i] {
+	case '\'', '"', '`':
+		quote := query[i]
+		for j := i + 1; j < len(query); j++ {
+			if query[j] != quote {
+				continue
+			}
+			if j+1 < len(query) && query[j+1] == quote {
+				//escaped quote
+				j++
+				continue
+			}
+			return j + 1
+		}
+	case '-':
+		if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+			return i + end + 1
+		}
+	case '/':
+		if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+			return i + 2 + end + 2
+		}
+	}
+	return len(query)
+}
+
+// bindNamed rewrites :name and @name parameters to positional placeholders.
+// Quoted literals, comments, :: casts, := assignments and @@ variables are kept,
+// @name not found in arg is kept as sql variable, while :name not found is an error.
+// Slice value(except []byte) is expanded to placeholders separated by comma for in (:ids).
+func bindNamed(query string, lookup namedLookup, placeholder func(n int) string) (string, []interface{}, error) {
+	var buf bytes.Buffer
+	var args []interface{}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case isLiteralStart(query, i):
+			end := skipLiteral(query, i)
+			buf.WriteString(query[i:end])
+			i = end - 1
+		case (c == ':' || c == '@') && i+1 < len(query) && query[i+1] == c:
+			buf.WriteString(query[i : i+2])
+			i++
+		case (c == ':' || c == '@') && i+1 < len(query) && isNameChar(query[i+1], true):
+			end := i + 2
+			for end < len(query) && isNameChar(query[end], false) {
+				end++
+			}
+			name := query[i+1 : end]
+			v, ok := lookup(name)
+			if !ok {
+				if c == ':' {
+					return "", nil, fmt.Errorf("named parameter %s not found", name)
+				}
+				buf.WriteString(query[i:end])
+				i = end - 1
+				continue
+			}
+			values := []interface{}{v}
+			if val := reflect.ValueOf(v); val.Kind() == reflect.Slice && val.Type().Elem().Kind() != reflect.Uint8 {
+				values = flattenArgs(values)
+			}
+			for j, value := range values {
+				if j > 0 {
+					buf.WriteString(",")
+				}
+				args = append(args, value)
+				buf.WriteString(placeholder(len(args)))
+			}
+			i = end - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), args, nil
+}
+
+//Binds named parameters, error is returned by next operation
+func (s *Session) bindNamed(query string, arg interface{}, placeholder func(n int) string) (string, []interface{}) {
+	lookup, err := newNamedLookup(arg, s.sqlGen.(valueGetter))
+	if err != nil {
+		s.err = err
+		return query, nil
+	}
+	sqlStr, args, err := bindNamed(query, lookup, placeholder)
+	if err != nil {
+		s.err = err
+		return query, nil
+	}
+	return sqlStr, args
+}
+
+// QueryNamed is Query with named parameters :name or @name from map or struct,
+// fields of struct are matched by column names.
+// Parameters are rewritten to positional placeholders of the driver, slice value is expanded for in.
+/*
+	Usage:
+		session.QueryNamed(`select * from T_Order
+			where CreatedTime >= :from and Status in (:status) and Remark <> 'a:b'`,
+			map[string]interface{}{"from": from, "status": []int{1, 2}}).Find(&orders)
+*/
+func (s *Session) QueryNamed(query string, arg interface{}) *Session {
+	placeholder := questionPlaceholder
+	if p, ok := placeholderDict[s.engine.driver]; ok {
+		placeholder = p
+	}
+	sqlStr, args := s.bindNamed(query, arg, placeholder)
+	return s.Query(sqlStr, args...)
+}
+
+// ExecNamed is Exec with named parameters, see QueryNamed
+func (s *Session) ExecNamed(sql string, arg interface{}) *Session {
+	return s.QueryNamed(sql, arg)
+}
+
+// WhereNamed is Where with named parameters, see QueryNamed
+func (s *Session) WhereNamed(clause string, arg interface{}) *Session {
+	sqlStr, args := s.bindNamed(clause, arg, questionPlaceholder)
+	return s.Where(sqlStr, args...)
+}
+
+// AndNamed is And with named parameters, see QueryNamed
+func (s *Session) AndNamed(clause string, arg interface{}) *Session {
+	sqlStr, args := s.bindNamed(clause, arg, questionPlaceholder)
+	return s.And(sqlStr, args...)
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBindNamed(t *testing.T) {
+	params := map[string]interface{}{"id": 1, "name": "sz", "ids": []int{2, 3}, "data": []byte("x")}
+	cases := []struct {
+		query       string
+		placeholder func(n int) string
+		sql         string
+		args        []interface{}
+		err         bool
+	}{
+		{"select * from T where Id=:id and Name=@name", questionPlaceholder,
+			"select * from T where Id=? and Name=?", []interface{}{1, "sz"}, false},
+		{"Id in (:ids) and Data=:data", placeholderDict["postgres"],
+			"Id in ($1,$2) and Data=$3", []interface{}{2, 3, []byte("x")}, false},
+		{"Remark='a:id''s @name' and Name=\"x:id\" and `:id`=:id", questionPlaceholder,
+			"Remark='a:id''s @name' and Name=\"x:id\" and `:id`=?", []interface{}{1}, false},
+		{"Time::date = :id -- :name\n/* @name */and @@identity>0 and @r=1, @v:=:id", questionPlaceholder,
+			"Time::date = ? -- :name\n/* @name */and @@identity>0 and @r=1, @v:=?", []interface{}{1, 1}, false},
+		{"Id=:missing", questionPlaceholder, "", nil, true},
+	}
+	lookup, err := newNamedLookup(params, newBaseGenerator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		sql, args, err := bindNamed(c.query, lookup, c.placeholder)
+		if (err != nil) != c.err {
+			t.Errorf("%q: unexpected error %v", c.query, err)
+			continue
+		}
+		if sql != c.sql || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%q:\n\texpected %q %v\n\tbut      %q %v", c.query, c.sql, c.args, sql, args)
+		}
+	}
+}
+
+func TestBindNamedStruct(t *testing.T) {
+	lookup, err := newNamedLookup(&genUser{Id: 7, UserName: "sz"}, newBaseGenerator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args, err := bindNamed("UserId=:userid and UserName=:UserName", lookup, questionPlaceholder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "UserId=? and UserName=?" || !reflect.DeepEqual(args, []interface{}{int64(7), "sz"}) {
+		t.Errorf("unexpected %q %v", sql, args)
+	}
+	if _, err = newNamedLookup(1, newBaseGenerator()); err == nil {
+		t.Errorf("expected error for int parameters")
+	}
+}
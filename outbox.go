@@ -0,0 +1,233 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Transactional outbox for reliable event publishing
+
+package shorm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// OutboxMessage is the message saved in outbox table in the same transaction with data changes.
+/*
+	Every db group needs the outbox table:
+	create table shorm_outbox(
+		Id bigint not null identity(1,1) primary key, -- auto_increment on mysql
+		Topic varchar(200) not null,
+		MsgKey varchar(200) not null default '',
+		Payload text not null,
+		CreatedTime datetime not null,
+		Delivered bit not null default 0 -- boolean on postgres
+	)
+	create index IX_Outbox_Delivered on shorm_outbox(Delivered, Id)
+
+	Relay of each group is claimed by lease on lock table of the group, see LockRecord for the DDL of shorm_lock.
+*/
+type OutboxMessage struct {
+	TabName     TableName `shorm:"shorm_outbox"`
+	Id          int64     `shorm:"Id,pk,auto"`
+	Topic       string    `shorm:",notnull"`
+	MsgKey      string    `shorm:",notnull"` //messages with the same key are published in order
+	Payload     string    `shorm:",notnull"`
+	CreatedTime time.Time
+	Delivered   bool `shorm:",notnull"`
+}
+
+// Publisher publishes outbox messages to message broker
+type Publisher interface {
+	Publish(msg *OutboxMessage) error
+}
+
+// PublisherFunc adapts function to Publisher
+type PublisherFunc func(msg *OutboxMessage) error
+
+func (f PublisherFunc) Publish(msg *OutboxMessage) error {
+	return f(msg)
+}
+
+// Publish writes message into outbox table in the transaction,
+// the message will be published by OutboxRelay after transaction committed.
+// Messages of the same topic are published in the order of writing.
+func (d *DbTrans) Publish(topic string, payload []byte) error {
+	return d.PublishWithKey(topic, topic, payload)
+}
+
+// PublishWithKey is Publish whose message is ordered with the messages of the same key rather than topic
+func (d *DbTrans) PublishWithKey(topic, key string, payload []byte) error {
+	msg := &OutboxMessage{
+		Topic:       topic,
+		MsgKey:      key,
+		Payload:     string(payload),
+		CreatedTime: time.Now(),
+	}
+	return d.session.insertWithTx(d.tx, msg)
+}
+
+// OutboxRelay polls outbox tables on master nodes of all groups,
+// hands undelivered messages to publisher and marks them delivered.
+// Messages are delivered at least once, consumers should be idempotent.
+// Outbox of a group is relayed by only one relay at a time, the relay holds lease of the group
+// on lock table of the group, relays of other processes skip the group until the lease expires.
+type OutboxRelay struct {
+	engine    *Engine
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+	owner     string
+	ttl       time.Duration //ttl of leases
+	lock      sync.Mutex
+	leases    map[*DbGroup]*relayLease
+	stop      chan struct{}
+	wait      sync.WaitGroup
+}
+
+//Lease of relaying group
+type relayLease struct {
+	*Lease
+	renewed time.Time
+}
+
+//Minimum ttl of relay lease
+const outboxLeaseTTL = time.Minute
+
+// StartOutboxRelay starts relaying outbox messages every interval, at most batchSize messages per group each time.
+/*
+	Usage:
+		relay := engine.StartOutboxRelay(shorm.PublisherFunc(func(msg *shorm.OutboxMessage) error {
+			return producer.Send(msg.Topic, msg.MsgKey, []byte(msg.Payload))
+		}), time.Second, 100)
+		defer relay.Stop()
+*/
+func (e *Engine) StartOutboxRelay(publisher Publisher, interval time.Duration, batchSize int) *OutboxRelay {
+	r := &OutboxRelay{
+		engine:    e,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+		owner:     newLockOwner(),
+		ttl:       outboxLeaseTTL,
+		leases:    make(map[*DbGroup]*relayLease),
+		stop:      make(chan struct{}),
+	}
+	if r.ttl < interval*3 {
+		r.ttl = interval * 3
+	}
+	r.wait.Add(1)
+	go r.run()
+	return r
+}
+
+// Stop stops relaying, waits for the current round finished and releases leases of groups
+func (r *OutboxRelay) Stop() {
+	close(r.stop)
+	r.wait.Wait()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for group, lease := range r.leases {
+		if err := lease.Release(context.Background()); err != nil {
+			r.engine.Logger.Printf("release outbox lease of group %s occurs error:%v\r\n", group.Name, err)
+		}
+		delete(r.leases, group)
+	}
+}
+
+//Claims or renews the lease of group, returns false if group is relayed by others
+func (r *OutboxRelay) claim(group *DbGroup) (bool, error) {
+	r.lock.Lock()
+	lease, ok := r.leases[group]
+	r.lock.Unlock()
+	if ok {
+		if time.Since(lease.renewed) < r.ttl/3 {
+			return true, nil
+		}
+		err := lease.Renew(context.Background())
+		if err == nil {
+			lease.renewed = time.Now()
+			return true, nil
+		}
+		r.lock.Lock()
+		delete(r.leases, group)
+		r.lock.Unlock()
+		if err != ErrLockLost {
+			return false, err
+		}
+	}
+	lease = &relayLease{Lease: &Lease{engine: r.engine, group: group, Name: "shorm_outbox_relay", Owner: r.owner, ttl: r.ttl}}
+	acquired, err := lease.tryAcquire()
+	if err != nil || !acquired {
+		return false, err
+	}
+	lease.renewed = time.Now()
+	r.lock.Lock()
+	r.leases[group] = lease
+	r.lock.Unlock()
+	return true, nil
+}
+
+func (r *OutboxRelay) run() {
+	defer r.wait.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			wait := &sync.WaitGroup{}
+			for _, g := range r.engine.getCluster().Groups {
+				wait.Add(1)
+				go func(group *DbGroup) {
+					defer wait.Done()
+					if _, err := r.RelayGroup(group); err != nil {
+						r.engine.Logger.Printf("relay outbox of group %s occurs error:%v\r\n", group.Name, err)
+					}
+				}(g)
+			}
+			wait.Wait()
+		}
+	}
+}
+
+// RelayGroup relays one batch of messages in outbox of group, returns count of delivered messages.
+// If a message fails to publish, the later messages with the same key are held until next round.
+// Nothing is relayed if the group is relayed by others.
+func (r *OutboxRelay) RelayGroup(group *DbGroup) (int, error) {
+	if claimed, err := r.claim(group); err != nil || !claimed {
+		return 0, err
+	}
+	s := r.engine.StartSession()
+	defer r.engine.EndSession(s)
+	var msgs []*OutboxMessage
+	err := s.onGroup(group).ForseMaster().Where("Delivered=?", false).
+		OrderBy("Id").Limit(0, r.batchSize).Find(&msgs)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	blocked := make(map[string]bool)
+	for _, msg := range msgs {
+		if msg.MsgKey != "" && blocked[msg.MsgKey] {
+			continue
+		}
+		//stop if lease expired during publishing, the group may be taken over by others
+		if claimed, err := r.claim(group); err != nil || !claimed {
+			return delivered, err
+		}
+		if err = r.publisher.Publish(msg); err != nil {
+			r.engine.Logger.Printf("publish outbox message %d of group %s occurs error:%v\r\n", msg.Id, group.Name, err)
+			blocked[msg.MsgKey] = true
+			continue
+		}
+		msg.Delivered = true
+		if _, err = s.onGroup(group).Id(msg.Id).Cols("Delivered").Update(msg); err != nil {
+			//message will be published again in next round
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Fake outbox and lock tables of one group
+type fakeOutbox struct {
+	lock      sync.Mutex
+	msgs      [][]driver.Value //Id, Topic, MsgKey, Payload, CreatedTime, Delivered
+	lockRow   []driver.Value   //LockName, Owner, Token, ExpireTime
+	delivered []int64
+}
+
+func (o *fakeOutbox) query(sqlStr string, args []driver.Value) ([]string, [][]driver.Value, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if strings.Contains(sqlStr, "shorm_lock") {
+		if o.lockRow == nil {
+			return []string{"LockName", "Owner", "Token", "ExpireTime"}, nil, nil
+		}
+		return []string{"LockName", "Owner", "Token", "ExpireTime"}, [][]driver.Value{o.lockRow}, nil
+	}
+	return []string{"Id", "Topic", "MsgKey", "Payload", "CreatedTime", "Delivered"}, o.msgs, nil
+}
+
+func (o *fakeOutbox) exec(sqlStr string, args []driver.Value) (int64, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	switch {
+	case strings.HasPrefix(sqlStr, "insert into `shorm_lock`"):
+		o.lockRow = args
+	case strings.HasPrefix(sqlStr, "update `shorm_outbox`"):
+		o.delivered = append(o.delivered, args[len(args)-1].(int64))
+	}
+	return 1, nil
+}
+
+func newFakeOutbox(db *fakeDb, keys ...string) *fakeOutbox {
+	o := &fakeOutbox{}
+	for i, key := range keys {
+		o.msgs = append(o.msgs, []driver.Value{int64(i + 1), "topic", key, fmt.Sprintf("msg%d", i+1), time.Now(), false})
+	}
+	db.query, db.exec = o.query, o.exec
+	return o
+}
+
+func TestRelayGroup(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	outbox := newFakeOutbox(db, "a", "b", "b", "a")
+	var published []string
+	relay := engine.StartOutboxRelay(PublisherFunc(func(msg *OutboxMessage) error {
+		published = append(published, msg.Payload)
+		if msg.Id == 2 {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}), time.Hour, 10)
+	defer relay.Stop()
+	n, err := relay.RelayGroup(engine.getCluster().Groups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || fmt.Sprint(published) != "[msg1 msg2 msg4]" {
+		t.Errorf("RelayGroup() = %d, published %v, want 2 delivered and msg3 held after msg2 failed", n, published)
+	}
+	if fmt.Sprint(outbox.delivered) != "[1 4]" {
+		t.Errorf("messages marked delivered = %v, want [1 4]", outbox.delivered)
+	}
+}
+
+func TestRelayGroupClaimed(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	outbox := newFakeOutbox(db, "a")
+	outbox.lockRow = []driver.Value{"shorm_outbox_relay", "other relay", int64(1), time.Now().Add(time.Minute)}
+	relay := engine.StartOutboxRelay(PublisherFunc(func(msg *OutboxMessage) error {
+		t.Errorf("message %d is published while group is relayed by others", msg.Id)
+		return nil
+	}), time.Hour, 10)
+	defer relay.Stop()
+	if n, err := relay.RelayGroup(engine.getCluster().Groups[0]); n != 0 || err != nil {
+		t.Errorf("RelayGroup() = %d, %v, want 0, nil", n, err)
+	}
+	if strings.Contains(db.log(), "shorm_outbox`") {
+		t.Errorf("outbox is queried without lease: %s", db.log())
+	}
+}
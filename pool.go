@@ -0,0 +1,106 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Connection pool settings of database nodes
+
+package shorm
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Duration is time.Duration which can be written as "30s", "5m" or "1h" in config file
+type Duration time.Duration
+
+// UnmarshalText parses duration string, such as "300ms", "1m30s"
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText formats duration as string, such as "1m30s"
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// PoolSettings configures connection pool of database node.
+// Settings of node override settings of group, which override settings of cluster,
+// zero value means inheriting or using the default of database/sql.
+/*
+	json config:
+	{
+	  "max_open_conns": 100,
+	  "max_idle_conns": 10,
+	  "conn_max_lifetime": "30m",
+	  "conn_max_idle_time": "5m"
+	}
+*/
+type PoolSettings struct {
+	MaxOpenConns    int      `json:"max_open_conns,omitempty" yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns,omitempty" yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime,omitempty" yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time,omitempty" yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+}
+
+//Fills the unset settings with parent's
+func (p PoolSettings) inherit(parent PoolSettings) PoolSettings {
+	if p.MaxOpenConns == 0 {
+		p.MaxOpenConns = parent.MaxOpenConns
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = parent.MaxIdleConns
+	}
+	if p.ConnMaxLifetime == 0 {
+		p.ConnMaxLifetime = parent.ConnMaxLifetime
+	}
+	if p.ConnMaxIdleTime == 0 {
+		p.ConnMaxIdleTime = parent.ConnMaxIdleTime
+	}
+	return p
+}
+
+func (p PoolSettings) apply(db *sql.DB) {
+	if p.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(time.Duration(p.ConnMaxLifetime))
+	}
+	if p.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(time.Duration(p.ConnMaxIdleTime))
+	}
+}
+
+//Applies pool settings to all opened nodes
+func (c *Cluster) applyPoolSettings() {
+	for _, g := range c.Groups {
+		settings := g.PoolSettings.inherit(c.PoolSettings)
+		for _, n := range g.Nodes {
+			if n.Db != nil {
+				n.PoolSettings.inherit(settings).apply(n.Db)
+			}
+		}
+	}
+}
+
+// Stats returns the connection pool statistics of all opened nodes, the key is node name
+func (e *Engine) Stats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats)
+	for _, g := range e.getCluster().Groups {
+		for _, n := range g.Nodes {
+			if n.Db != nil {
+				stats[n.Name] = n.Db.Stats()
+			}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Hot reload of cluster configuration
+
+package shorm
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Reload replaces the cluster of engine without restarting.
+// Nodes which have the same name and connection string with the running ones are reused,
+// new nodes are opened before switching. Sessions started after Reload work on new cluster,
+// removed nodes will be closed after all sessions started before Reload are ended.
+// Concurrent calls of Reload are serialized.
+func (e *Engine) Reload(cluster *Cluster) error {
+	e.reloadLock.Lock()
+	defer e.reloadLock.Unlock()
+	if err := cluster.Validate(); err != nil {
+		return err
+	}
+	cluster.RealGroups = len(cluster.Groups)
+	old := e.getCluster()
+	if old == cluster {
+		return nil
+	}
+	running := make(map[string]*DbNode)
+	for _, g := range old.Groups {
+		for _, n := range g.Nodes {
+			if n.Db != nil {
+				running[n.Name+"\x00"+n.ConnStr] = n
+			}
+		}
+	}
+	reused := make(map[*DbNode]bool)
+	var opened []*DbNode
+	for _, g := range cluster.Groups {
+		for _, n := range g.Nodes {
+			if r, ok := running[n.Name+"\x00"+n.ConnStr]; ok {
+				n.Db = r.Db
+				reused[r] = true
+				continue
+			}
+			if err := n.open(e.driver); err != nil {
+				for _, o := range opened {
+					o.Db.Close()
+				}
+				return fmt.Errorf("open node %s occurs error:%v", n.Name, err)
+			}
+			opened = append(opened, n)
+		}
+	}
+
+	cluster.applyPoolSettings()
+
+	e.clusterLock.Lock()
+	e.cluster = cluster
+	e.clusterLock.Unlock()
+	e.Logger.Printf("cluster reloaded, %d groups, %d new nodes\r\n", len(cluster.Groups), len(opened))
+
+	drained := old.retire()
+	go func() {
+		<-drained
+		for _, g := range old.Groups {
+			for _, n := range g.Nodes {
+				if n.Db == nil || reused[n] {
+					continue
+				}
+				if err := n.Db.Close(); err != nil {
+					e.Logger.Printf("close removed node %s occurs error:%v\r\n", n.Name, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// ReloadConfig reloads cluster from config file, see NewEngineFromConfig for the file format.
+func (e *Engine) ReloadConfig(config string) error {
+	cfg, err := loadClusterConfig(config)
+	if err != nil {
+		return err
+	}
+	if cfg.Driver != e.driver {
+		return fmt.Errorf("driver of config file is %s, can not change driver %s of running engine", cfg.Driver, e.driver)
+	}
+	return e.Reload(cfg.Cluster)
+}
+
+// WatchConfig checks modification of config file every interval,
+// and reloads cluster once the file changed. Errors are written to engine logger.
+// Watching stops when StopWatch or Close is called.
+func (e *Engine) WatchConfig(config string, interval time.Duration) error {
+	info, err := os.Stat(config)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	e.clusterLock.Lock()
+	if e.watchStop != nil {
+		close(e.watchStop)
+	}
+	e.watchStop = stop
+	e.clusterLock.Unlock()
+
+	lastMod := info.ModTime()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(config)
+				if err != nil {
+					e.Logger.Printf("watch config %s occurs error:%v\r\n", config, err)
+					continue
+				}
+				if !info.ModTime().After(lastMod) {
+					continue
+				}
+				lastMod = info.ModTime()
+				if err = e.ReloadConfig(config); err != nil {
+					e.Logger.Printf("reload config %s occurs error:%v\r\n", config, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatch stops watching config file
+func (e *Engine) StopWatch() {
+	e.clusterLock.Lock()
+	defer e.clusterLock.Unlock()
+	if e.watchStop != nil {
+		close(e.watchStop)
+		e.watchStop = nil
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"testing"
+)
+
+func TestSessionRefCount(t *testing.T) {
+	engine, _ := newFakeEngine("mysql")
+	cluster := engine.getCluster()
+	s := engine.StartSession()
+	copy := s.Copy()
+	engine.EndSession(s)
+	engine.EndSession(s)
+	if cluster.sessions != 1 {
+		t.Errorf("sessions = %d after ending origin twice, want 1 for the copy", cluster.sessions)
+	}
+	engine.EndSession(copy)
+	if cluster.sessions != 0 {
+		t.Errorf("sessions = %d after ending copy, want 0", cluster.sessions)
+	}
+}
+
+func TestReloadDrain(t *testing.T) {
+	engine, _ := newFakeEngine("mysql")
+	old := engine.getCluster()
+	s := engine.StartSession()
+	//the node is reused by name and connection string
+	master := old.Groups[0].Nodes[0]
+	cluster := &Cluster{TotalGroups: 1, Groups: []*DbGroup{
+		{Name: "g1", RangeFrom: 0, RangeTo: 1, Nodes: []*DbNode{{Name: master.Name, ConnStr: master.ConnStr, Type: NodeType_Master}}},
+	}}
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- engine.Reload(cluster) }()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if engine.getCluster() != cluster {
+		t.Fatalf("cluster is not swapped")
+	}
+	if old.drained == nil {
+		t.Errorf("old cluster is drained while session is working on it")
+	}
+	engine.EndSession(s)
+	if old.drained != nil {
+		t.Errorf("old cluster is not drained after session ended")
+	}
+}
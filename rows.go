@@ -0,0 +1,445 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Streaming cursor of query results across shards
+
+package shorm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Cursor of results of one db node
+type shardCursor struct {
+	group    *DbGroup
+	nodeName string
+	db       *sql.DB
+	rows     *sql.Rows
+	scanner  *rowScanner
+	current  valuePairs
+	keys     []interface{} //values of order by columns of current row
+}
+
+func (c *shardCursor) wrapErr(err error) error {
+	return &ShardError{Group: c.group.Name, Node: c.nodeName, Err: err}
+}
+
+func (c *shardCursor) open(ctx context.Context, table *TableMetadata, sqlStr string, args []interface{}) error {
+	rows, err := c.db.QueryContext(ctx, sqlStr, args...)
+	if err != nil {
+		return c.wrapErr(err)
+	}
+	c.rows = rows
+	if c.scanner, err = newRowScanner(rows, table.Columns, false); err != nil {
+		return c.wrapErr(err)
+	}
+	return nil
+}
+
+//Moves to next row, keys are the indexes of order by columns
+func (c *shardCursor) next(keys []int) (bool, error) {
+	if !c.rows.Next() {
+		c.current = nil
+		if err := c.rows.Err(); err != nil {
+			return false, c.wrapErr(err)
+		}
+		return false, nil
+	}
+	pairs, err := c.scanner.scan(c.rows)
+	if err != nil {
+		return false, c.wrapErr(err)
+	}
+	c.current = pairs
+	c.keys = c.keys[:0]
+	for _, i := range keys {
+		c.keys = append(c.keys, sortValue(reflect.ValueOf(c.scanner.values[i]).Elem().Interface()))
+	}
+	return true, nil
+}
+
+func (c *shardCursor) close() {
+	if c.rows != nil {
+		c.rows.Close()
+	}
+}
+
+//Column of order by clause
+type orderKey struct {
+	index int //index in selected columns
+	desc  bool
+}
+
+// Rows is the cursor of query results, rows are streamed from db nodes one by one,
+// or merged in order of OrderBy from all db nodes, without loading all results into memory.
+// Rows must be closed if not iterated to the end, the cluster is held until Rows is closed.
+//
+// Rows of db nodes are merged by comparing values of order by columns in Go, not by rules of database:
+// strings are compared byte by byte regardless of collation, and null is less than any value
+// whatever the database places nulls, so use binary collation and non-null columns for strict order.
+type Rows struct {
+	cluster *Cluster
+	table   *TableMetadata
+	sqlStr  string
+	args    []interface{}
+	cursors []*shardCursor
+	orders  []orderKey
+	ctx     context.Context
+	cancel  context.CancelFunc
+	opened  int          //count of opened cursors
+	current *shardCursor //cursor of current row
+	err     error
+}
+
+// Rows executes query and returns cursor of results mapped to model.
+// Without shard value, rows of all groups are streamed group by group,
+// or merged in order if OrderBy is specified, whose columns must be selected.
+/*
+	Usage:
+		rows, err := session.Where("CreatedTime>?", from).OrderBy("CreatedTime").Rows(&Order{})
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var order Order
+			if err = rows.Scan(&order); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+*/
+func (s *Session) Rows(model interface{}) (*Rows, error) {
+	defer s.reset()
+	if s.err != nil {
+		return nil, s.err
+	}
+	if err := s.checkRowLock(); err != nil {
+		return nil, err
+	}
+	table, err := s.getTable(model)
+	if err != nil {
+		return nil, err
+	}
+	sqlStr, args := s.sqlGen.GenSelect(table, s.clauseList)
+	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
+	if err = s.checkTableScan(sqlStr); err != nil {
+		return nil, err
+	}
+	r := &Rows{table: table, sqlStr: sqlStr, args: args}
+	if s.hasShardKey || s.cluster.has1DbGroup() {
+		if !s.hasShardKey {
+			if err = s.useDefaultGroup(); err != nil {
+				return nil, err
+			}
+		}
+		node, err := s.readNode(s.group)
+		if err != nil {
+			return nil, err
+		}
+		r.cursors = []*shardCursor{{group: s.group, nodeName: node.Name, db: node.Db}}
+	} else {
+		if err = s.checkJoin(table); err != nil {
+			return nil, err
+		}
+		nodes, err := s.readNodes()
+		if err != nil {
+			return nil, err
+		}
+		for i, node := range nodes {
+			r.cursors = append(r.cursors, &shardCursor{group: s.cluster.Groups[i], nodeName: node.Name, db: node.Db})
+		}
+	}
+	//cursors outlive the session, hold the cluster from being retired by reloading until rows are closed
+	r.cluster = s.cluster
+	r.cluster.acquire()
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	if len(r.cursors) > 1 {
+		for _, c := range s.clauseList {
+			if c.op == opType_orderby {
+				if err = r.openAll(c.clause); err != nil {
+					r.Close()
+					return nil, err
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+//Opens cursors of all nodes concurrently for merging rows in order
+func (r *Rows) openAll(orderBy string) error {
+	wg := &sync.WaitGroup{}
+	errs := make([]error, len(r.cursors))
+	for i, c := range r.cursors {
+		wg.Add(1)
+		go func(i int, c *shardCursor) {
+			defer wg.Done()
+			errs[i] = c.open(r.ctx, r.table, r.sqlStr, r.args)
+		}(i, c)
+	}
+	wg.Wait()
+	r.opened = len(r.cursors)
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	cols, err := r.cursors[0].rows.Columns()
+	if err != nil {
+		return err
+	}
+	if r.orders, err = parseOrderBy(orderBy, cols); err != nil {
+		return err
+	}
+	for _, c := range r.cursors {
+		if _, err = c.next(r.orderIndexes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rows) orderIndexes() []int {
+	indexes := make([]int, len(r.orders))
+	for i := range r.orders {
+		indexes[i] = r.orders[i].index
+	}
+	return indexes
+}
+
+//Parses order by clause into indexes of selected columns
+func parseOrderBy(orderBy string, cols []string) ([]orderKey, error) {
+	keys := make([]orderKey, 0)
+	for _, item := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(item)
+		if len(fields) <= 0 {
+			continue
+		}
+		name := normalizeSql(fields[0])
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		key := orderKey{index: -1, desc: len(fields) > 1 && strings.EqualFold(fields[1], "desc")}
+		for i, col := range cols {
+			if strings.EqualFold(col, name) {
+				key.index = i
+				break
+			}
+		}
+		if key.index < 0 {
+			return nil, fmt.Errorf("order by %s is not selected, rows of groups can not be merged", fields[0])
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Next prepares the next row for Scan, returns false if no more rows or error occurred
+func (r *Rows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.orders != nil {
+		return r.nextInOrder()
+	}
+	for {
+		if r.current == nil {
+			if r.opened >= len(r.cursors) {
+				return false
+			}
+			r.current = r.cursors[r.opened]
+			r.opened++
+			if r.err = r.current.open(r.ctx, r.table, r.sqlStr, r.args); r.err != nil {
+				return false
+			}
+		}
+		ok, err := r.current.next(nil)
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if ok {
+			return true
+		}
+		r.current.close()
+		r.current = nil
+	}
+}
+
+//Picks the least current row of cursors, then the cursor of picked row moves on next call
+func (r *Rows) nextInOrder() bool {
+	if r.current != nil {
+		if _, r.err = r.current.next(r.orderIndexes()); r.err != nil {
+			return false
+		}
+	}
+	r.current = nil
+	for _, c := range r.cursors {
+		if c.current == nil {
+			continue
+		}
+		if r.current == nil || r.less(c, r.current) {
+			r.current = c
+		}
+	}
+	return r.current != nil
+}
+
+func (r *Rows) less(a, b *shardCursor) bool {
+	for i, order := range r.orders {
+		n := compareValue(a.keys[i], b.keys[i])
+		if n == 0 {
+			continue
+		}
+		return (n < 0) != order.desc
+	}
+	return false
+}
+
+// Scan copies columns of current row into model
+func (r *Rows) Scan(model interface{}) error {
+	if r.current == nil || r.current.current == nil {
+		return fmt.Errorf("scan called without calling Next")
+	}
+	return assignValueToStruct(r.current.current, reflect.ValueOf(model))
+}
+
+// Err returns the error occurred during iteration
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close cancels queries and closes cursors of all db nodes
+func (r *Rows) Close() error {
+	r.cancel()
+	for _, c := range r.cursors {
+		c.close()
+	}
+	r.current = nil
+	if r.cluster != nil {
+		r.cluster.release()
+		r.cluster = nil
+	}
+	return nil
+}
+
+// Iterate calls fn with each row mapped to a new value of model's type, see Rows.
+// Iteration stops and all cursors are closed if fn returns error, which is returned by Iterate.
+/*
+	Usage:
+		err := session.Where("Status=?", 1).Iterate(&Order{}, func(row interface{}) error {
+			order := row.(*Order)
+			return writer.Write(order)
+		})
+*/
+func (s *Session) Iterate(model interface{}, fn func(row interface{}) error) error {
+	rows, err := s.Rows(model)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	elemType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for rows.Next() {
+		row := reflect.New(elemType)
+		if err = rows.Scan(row.Interface()); err != nil {
+			return err
+		}
+		if err = fn(row.Interface()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+//Normalizes value scanned from db for comparing, null is nil
+func sortValue(v interface{}) interface{} {
+	if valuer, ok := v.(driver.Valuer); ok {
+		v, _ = valuer.Value()
+	}
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return val.Uint()
+	case reflect.Float32, reflect.Float64:
+		return val.Float()
+	case reflect.String:
+		return val.String()
+	case reflect.Slice:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte(nil), val.Bytes()...)
+		}
+	case reflect.Invalid:
+		return nil
+	}
+	return val.Interface()
+}
+
+//Compares values normalized by sortValue, null is less than any value
+func compareValue(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return compareOrdered(x < y, x > y)
+		}
+	case uint64:
+		if y, ok := b.(uint64); ok {
+			return compareOrdered(x < y, x > y)
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			return compareOrdered(x < y, x > y)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return compareOrdered(!x && y, x && !y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return compareOrdered(x.Before(y), x.After(y))
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareOrdered(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	cols := []string{"OrderId", "UserId", "CreatedTime"}
+	keys, err := parseOrderBy("o.`CreatedTime` DESC, [userid]", cols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []orderKey{{index: 2, desc: true}, {index: 1}}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, but %v", expected, keys)
+	}
+	if _, err = parseOrderBy("Amount", cols); err == nil {
+		t.Error("expected error of order by column not selected")
+	}
+}
+
+func TestCompareValue(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Second)
+	var nilTime *time.Time
+	cases := []struct {
+		a, b     interface{}
+		expected int
+	}{
+		{sql.NullInt64{Int64: 1, Valid: true}, sql.NullInt64{Int64: 2, Valid: true}, -1},
+		{int32(3), int32(2), 1},
+		{sql.NullString{String: "b", Valid: true}, sql.NullString{String: "b", Valid: true}, 0},
+		{sql.NullString{}, sql.NullString{String: "a", Valid: true}, -1},
+		{sql.NullFloat64{Float64: 1.5, Valid: true}, sql.NullFloat64{}, 1},
+		{&later, &now, 1},
+		{nilTime, &now, -1},
+		{[]byte("a"), []byte("b"), -1},
+	}
+	for _, c := range cases {
+		if n := compareValue(sortValue(c.a), sortValue(c.b)); n != c.expected {
+			t.Errorf("compare %v with %v: expected %d, but %d", c.a, c.b, c.expected, n)
+		}
+	}
+}
+
+func TestRowsHoldCluster(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	fakeResult(dbs[:1], []string{"UserId", "UserName", "Age"}, []driver.Value{int64(1), "a", int64(20)}, []driver.Value{int64(3), "c", int64(20)})
+	fakeResult(dbs[1:], []string{"UserId", "UserName", "Age"}, []driver.Value{int64(2), "b", int64(20)})
+	cluster := engine.getCluster()
+	s := engine.StartSession()
+	rows, err := s.Where("Age>?", 18).OrderBy("UserId").Rows(&genUser{})
+	engine.EndSession(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.sessions != 1 {
+		t.Errorf("sessions = %d after ending session, want 1 for the rows", cluster.sessions)
+	}
+	var ids []int64
+	for rows.Next() {
+		var user genUser
+		if err = rows.Scan(&user); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.Id)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Errorf("expected rows merged in order [1 2 3], but %v", ids)
+	}
+	rows.Close()
+	rows.Close()
+	if cluster.sessions != 0 {
+		t.Errorf("sessions = %d after closing rows twice, want 0", cluster.sessions)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Saga coordinator for multi-shard business operations
+
+package shorm
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status of saga
+const (
+	SagaStatus_Running      = "running"
+	SagaStatus_Completed    = "completed"
+	SagaStatus_Compensating = "compensating"
+	SagaStatus_Compensated  = "compensated"
+)
+
+// SagaState is the state of saga persisted on default group.
+/*
+	create table shorm_saga(
+		SagaId varchar(64) not null primary key,
+		Name varchar(200) not null,
+		Payload text not null,
+		Status varchar(20) not null,
+		Step int not null,
+		UpdatedTime datetime not null
+	)
+*/
+type SagaState struct {
+	TabName     TableName `shorm:"shorm_saga"`
+	SagaId      string    `shorm:",pk,notnull"`
+	Name        string    `shorm:",notnull"`
+	Payload     string    `shorm:",notnull"`
+	Status      string    `shorm:",notnull"`
+	Step        int       `shorm:",notnull"` //count of started steps
+	UpdatedTime time.Time
+}
+
+// SagaStep is one local transaction of saga
+type SagaStep struct {
+	Name       string
+	ShardValue int64
+	Action     func(tx *DbTrans) error
+	Compensate func(tx *DbTrans) error
+}
+
+// Saga executes steps as local transactions in order,
+// if one step fails, compensations of the previous steps are executed in reverse order.
+// Compensation may be executed during recovery while its action was not committed,
+// so it must be idempotent and tolerate missing changes.
+/*
+	Usage:
+		saga := engine.NewSaga("transfer", payload).
+			Step("debit", from.Id, debit, refund).
+			Step("credit", to.Id, credit, undoCredit)
+		err := saga.Execute()
+*/
+type Saga struct {
+	engine  *Engine
+	Id      string
+	Name    string
+	Payload []byte
+	steps   []SagaStep
+}
+
+// NewSaga creates saga, name and payload are persisted to rebuild the saga on recovery
+func (e *Engine) NewSaga(name string, payload []byte) *Saga {
+	id, _ := newXid()
+	return &Saga{engine: e, Id: id, Name: name, Payload: payload}
+}
+
+// Step appends step to saga, compensate can be nil if the action needs no compensation
+func (s *Saga) Step(name string, shardValue int64, action, compensate func(tx *DbTrans) error) *Saga {
+	s.steps = append(s.steps, SagaStep{Name: name, ShardValue: shardValue, Action: action, Compensate: compensate})
+	return s
+}
+
+func (s *Saga) save(state *SagaState, insert bool) error {
+	group, err := s.engine.getCluster().DefaultGroup()
+	if err != nil {
+		return err
+	}
+	session := s.engine.StartSession()
+	defer s.engine.EndSession(session)
+	state.UpdatedTime = time.Now()
+	if insert {
+		_, err = session.onGroup(group).Insert(state)
+		return err
+	}
+	_, err = session.onGroup(group).Id(state.SagaId).Cols("Status,Step,UpdatedTime").Update(state)
+	return err
+}
+
+// Execute executes all steps, returns error of the failed step after compensated
+func (s *Saga) Execute() error {
+	state := &SagaState{SagaId: s.Id, Name: s.Name, Payload: string(s.Payload), Status: SagaStatus_Running}
+	if err := s.save(state, true); err != nil {
+		return err
+	}
+	for i, step := range s.steps {
+		state.Step = i + 1
+		if err := s.save(state, false); err != nil {
+			return s.compensate(state, i, err)
+		}
+		if err := s.engine.WithTrans(step.ShardValue, step.Action); err != nil {
+			//the failed step has been rolled back
+			return s.compensate(state, i, fmt.Errorf("saga %s step %s occurs error:%v", s.Name, step.Name, err))
+		}
+	}
+	state.Status = SagaStatus_Completed
+	return s.save(state, false)
+}
+
+//Compensates steps[0:started] in reverse order
+func (s *Saga) compensate(state *SagaState, started int, cause error) error {
+	state.Status = SagaStatus_Compensating
+	if err := s.save(state, false); err != nil {
+		return fmt.Errorf("%v, save saga state occurs error:%v", cause, err)
+	}
+	for i := started - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if step.Compensate != nil {
+			if err := s.engine.WithTrans(step.ShardValue, step.Compensate); err != nil {
+				//left compensating, will be continued by RecoverSagas
+				return fmt.Errorf("%v, compensate step %s occurs error:%v", cause, step.Name, err)
+			}
+		}
+		state.Step = i
+		if err := s.save(state, false); err != nil {
+			return fmt.Errorf("%v, save saga state occurs error:%v", cause, err)
+		}
+	}
+	state.Status = SagaStatus_Compensated
+	if err := s.save(state, false); err != nil {
+		return fmt.Errorf("%v, save saga state occurs error:%v", cause, err)
+	}
+	return cause
+}
+
+// RecoverSagas compensates sagas interrupted by crash, which are running or compensating
+// and not updated within olderThan. build rebuilds the saga steps from name and payload.
+func (e *Engine) RecoverSagas(olderThan time.Duration, build func(name string, payload []byte) (*Saga, error)) error {
+	group, err := e.getCluster().DefaultGroup()
+	if err != nil {
+		return err
+	}
+	session := e.StartSession()
+	defer e.EndSession(session)
+	var states []*SagaState
+	err = session.onGroup(group).ForseMaster().In("Status", SagaStatus_Running, SagaStatus_Compensating).
+		And("UpdatedTime<?", time.Now().Add(-olderThan)).Find(&states)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, state := range states {
+		saga, err := build(state.Name, []byte(state.Payload))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("build saga %s(%s) occurs error:%v", state.Name, state.SagaId, err))
+			continue
+		}
+		saga.engine = e
+		saga.Id = state.SagaId
+		if state.Step > len(saga.steps) {
+			errs = append(errs, fmt.Errorf("saga %s(%s) has %d steps, but %d started", state.Name, state.SagaId, len(saga.steps), state.Step))
+			continue
+		}
+		cause := fmt.Errorf("saga %s(%s) recovered", state.Name, state.SagaId)
+		if err = saga.compensate(state, state.Step, cause); err != cause {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("recover sagas occurs error:%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+//Creates engine of 2 groups whose default group records saga status saved
+func newSagaEngine() (*Engine, []*fakeDb, *[]string) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	engine.getCluster().Groups[0].IsDefault = true
+	var statuses []string
+	dbs[0].exec = func(sqlStr string, args []driver.Value) (int64, error) {
+		if strings.HasPrefix(sqlStr, "update `shorm_saga`") {
+			statuses = append(statuses, fmt.Sprintf("%v:%v", args[0], args[1]))
+		}
+		return 1, nil
+	}
+	return engine, dbs, &statuses
+}
+
+func sagaStep(calls *[]string, name string, err error) func(tx *DbTrans) error {
+	return func(tx *DbTrans) error {
+		*calls = append(*calls, name)
+		return err
+	}
+}
+
+func TestSagaExecute(t *testing.T) {
+	engine, dbs, statuses := newSagaEngine()
+	var calls []string
+	err := engine.NewSaga("transfer", []byte("{}")).
+		Step("debit", 0, sagaStep(&calls, "debit", nil), sagaStep(&calls, "refund", nil)).
+		Step("credit", 1, sagaStep(&calls, "credit", nil), sagaStep(&calls, "undo credit", nil)).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(calls); got != "[debit credit]" {
+		t.Errorf("steps executed = %s, want [debit credit]", got)
+	}
+	if got := fmt.Sprint(*statuses); got != "[running:1 running:2 completed:2]" {
+		t.Errorf("saga states saved = %s", got)
+	}
+	if !strings.Contains(dbs[1].log(), "begin;commit") {
+		t.Errorf("step credit is not executed in transaction on group 2: %s", dbs[1].log())
+	}
+}
+
+func TestSagaCompensate(t *testing.T) {
+	engine, dbs, statuses := newSagaEngine()
+	var calls []string
+	errCredit := errors.New("account frozen")
+	err := engine.NewSaga("transfer", []byte("{}")).
+		Step("debit", 0, sagaStep(&calls, "debit", nil), sagaStep(&calls, "refund", nil)).
+		Step("notify", 0, sagaStep(&calls, "notify", nil), nil).
+		Step("credit", 1, sagaStep(&calls, "credit", errCredit), sagaStep(&calls, "undo credit", nil)).
+		Execute()
+	if err == nil || !strings.Contains(err.Error(), errCredit.Error()) {
+		t.Fatalf("Execute() error = %v, want error of step credit", err)
+	}
+	//compensations of started steps run in reverse order, the failed step has been rolled back
+	if got := fmt.Sprint(calls); got != "[debit notify credit refund]" {
+		t.Errorf("steps executed = %s, want [debit notify credit refund]", got)
+	}
+	want := "[running:1 running:2 running:3 compensating:3 compensating:1 compensating:0 compensated:0]"
+	if got := fmt.Sprint(*statuses); got != want {
+		t.Errorf("saga states saved = %s, want %s", got, want)
+	}
+	if got := dbs[1].log(); got != "begin;rollback" {
+		t.Errorf("statements on group 2 = %q, want begin;rollback", got)
+	}
+}
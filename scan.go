@@ -7,11 +7,11 @@
 package shorm
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"reflect"
-	"strings"
 	"time"
 )
 
@@ -26,25 +26,51 @@ type valuePair struct {
 	isNullable, isDBConverter bool
 }
 
-func row2Slice(rows *sql.Rows, colMap ColMetadataMap) (valuePairList, error) {
+//Scans rows into value pairs, adhoc is true for results of raw query, see ColMetadataMap.matchAdhoc
+func row2Slice(rows *sql.Rows, colMap ColMetadataMap, adhoc bool) (valuePairList, error) {
 	defer rows.Close()
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-
-	rowCols, err := rows.Columns()
+	scanner, err := newRowScanner(rows, colMap, adhoc)
 	if err != nil {
 		return nil, err
 	}
-	values := make([]interface{}, 0, len(rowCols))
 	result := make(valuePairList, 0)
-	pairs := make(valuePairs, len(rowCols))
+	//before call this function, rows.Next() has been called
+	for ok := true; ok; ok = rows.Next() {
+		pairRow, err := scanner.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pairRow)
+	}
+	return result, nil
+}
+
+//Scans row into value pairs of mapped columns
+type rowScanner struct {
+	values []interface{}
+	pairs  valuePairs
+}
 
+func newRowScanner(rows *sql.Rows, colMap ColMetadataMap, adhoc bool) (*rowScanner, error) {
+	rowCols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	match := colMap.match
+	if adhoc {
+		match = colMap.matchAdhoc
+	}
+	r := &rowScanner{
+		values: make([]interface{}, 0, len(rowCols)),
+		pairs:  make(valuePairs, len(rowCols)),
+	}
 	for i := range rowCols {
-		if v, ok := colMap[strings.ToLower(rowCols[i])]; ok {
-			values = append(values, reflect.New(v.dbType).Interface())
-			// fmt.Println(v.name, v.dbType.Name(), v.parentFieldIndex)
-			pairs[i] = valuePair{
+		if v, ok := match(rowCols[i]); ok {
+			r.values = append(r.values, reflect.New(v.dbType).Interface())
+			r.pairs[i] = valuePair{
 				pindex:        v.parentFieldIndex,
 				index:         v.fieldIndex,
 				specialType:   v.specialType,
@@ -52,46 +78,128 @@ func row2Slice(rows *sql.Rows, colMap ColMetadataMap) (valuePairList, error) {
 				isDBConverter: v.isDBConverter,
 			}
 		} else {
-			values = append(values, &sql.RawBytes{})
+			r.values = append(r.values, &sql.RawBytes{})
+		}
+	}
+	return r, nil
+}
+
+//Scans current row of rows
+func (r *rowScanner) scan(rows *sql.Rows) (valuePairs, error) {
+	if err := rows.Scan(r.values...); err != nil {
+		return nil, err
+	}
+	pairRow := make(valuePairs, len(r.pairs))
+	for i, v := range r.values {
+		if len(r.pairs[i].index) <= 0 {
+			continue
+		}
+		pairRow[i] = r.pairs[i]
+		if r.pairs[i].specialType == specialType_rawbytes {
+			rawBytes := reflect.ValueOf(v).Elem().Interface().(sql.RawBytes)
+			slice := make([]byte, 0, len(rawBytes))
+			pairRow[i].value = append(slice, rawBytes...)
+		} else {
+			pairRow[i].value = reflect.ValueOf(v).Elem().Interface()
+		}
+	}
+	return pairRow, nil
+}
+
+//Removes duplicate rows, the first one is kept
+func (list valuePairList) distinct() valuePairList {
+	seen := make(map[string]bool, len(list))
+	result := list[:0]
+	for _, pairs := range list {
+		values := make([]interface{}, len(pairs))
+		for i := range pairs {
+			values[i] = pairs[i].value
+		}
+		key := distinctKey(values...)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, pairs)
+	}
+	return result
+}
+
+//Key of values for de-duplication, pointers are dereferenced
+func distinctKey(values ...interface{}) string {
+	var buf bytes.Buffer
+	for _, v := range values {
+		val := reflect.ValueOf(v)
+		for val.Kind() == reflect.Ptr && !val.IsNil() {
+			val = val.Elem()
+		}
+		if val.IsValid() {
+			fmt.Fprintf(&buf, "%#v|", val.Interface())
+		} else {
+			buf.WriteString("nil|")
 		}
 	}
+	return buf.String()
+}
 
-	var pairRow valuePairs
-	fnParseValue := func(vals []interface{}) {
-		pairRow = make(valuePairs, len(pairs))
-		for i, v := range vals {
-			if len(pairs[i].index) <= 0 {
+//Scans the first column of rows into slice, rows.Next() has been called.
+//Values in seen are skipped if seen is not nil.
+func scanColumn(rows *sql.Rows, slice reflect.Value, seen map[string]bool) error {
+	defer rows.Close()
+	elemType := slice.Type().Elem()
+	for ok := true; ok; ok = rows.Next() {
+		v := reflect.New(elemType)
+		if err := rows.Scan(v.Interface()); err != nil {
+			return err
+		}
+		if seen != nil {
+			key := distinctKey(v.Interface())
+			if seen[key] {
 				continue
 			}
-			pairRow[i].pindex = pairs[i].pindex
-			pairRow[i].index = pairs[i].index
-			pairRow[i].specialType = pairs[i].specialType
-			pairRow[i].isNullable = pairs[i].isNullable
-			pairRow[i].isDBConverter = pairs[i].isDBConverter
-			if pairs[i].specialType == specialType_rawbytes {
-				rawBytes := reflect.ValueOf(v).Elem().Interface().(sql.RawBytes)
-				slice := make([]byte, 0, len(rawBytes))
-				pairRow[i].value = append(slice, rawBytes...)
-			} else {
-				pairRow[i].value = reflect.ValueOf(v).Elem().Interface()
-			}
+			seen[key] = true
 		}
-		result = append(result, pairRow)
+		slice.Set(reflect.Append(slice, v.Elem()))
 	}
+	return rows.Err()
+}
 
-	//before call this function, rows.Next() has been called
-	if err = rows.Scan(values...); err != nil {
-		return nil, err
+//Scans rows into maps of column name to value, rows.Next() has been called.
+//Rows in seen are skipped if seen is not nil.
+func scanMaps(rows *sql.Rows, maps *[]map[string]interface{}, seen map[string]bool) error {
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
 	}
-	fnParseValue(values)
-
-	for rows.Next() {
-		if err = rows.Scan(values...); err != nil {
-			return nil, err
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for ok := true; ok; ok = rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			return err
 		}
-		fnParseValue(values)
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if seen != nil {
+			key := distinctKey(values...)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		m := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			m[col] = values[i]
+		}
+		*maps = append(*maps, m)
 	}
-	return result, nil
+	return rows.Err()
 }
 
 func toStruct(list valuePairList, model interface{}) error {
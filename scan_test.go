@@ -0,0 +1,161 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type cityStat struct {
+	City        string
+	TotalAmount float64
+	Users       int64 `shorm:"user_count"`
+}
+
+//Both columns match user__count if underscores are ignored
+type ambiguousStat struct {
+	Users     int64 `shorm:"user_count"`
+	UserCount int64
+}
+
+func TestColumnMatch(t *testing.T) {
+	table, err := getTableMeta(cityStat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		col   string
+		adhoc bool
+		field string
+	}{
+		{"city", false, "City"},
+		{"TOTAL_AMOUNT", false, ""},
+		{"TOTAL_AMOUNT", true, "TotalAmount"},
+		{"user_count", false, "user_count"},
+		{"UserCount", false, ""},
+		{"UserCount", true, "user_count"},
+		{"total", true, ""},
+	}
+	for _, c := range cases {
+		match := table.Columns.match
+		if c.adhoc {
+			match = table.Columns.matchAdhoc
+		}
+		col, ok := match(c.col)
+		if c.field == "" {
+			if ok {
+				t.Errorf("%s(adhoc %v): expected no column, but %s", c.col, c.adhoc, col.name)
+			}
+			continue
+		}
+		if !ok || col.name != c.field {
+			t.Errorf("%s(adhoc %v): expected column %s, but %v", c.col, c.adhoc, c.field, col)
+		}
+	}
+
+	table, err = getTableMeta(ambiguousStat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col, ok := table.Columns.matchAdhoc("USER_COUNT"); !ok || col.name != "user_count" {
+		t.Errorf("USER_COUNT: expected column user_count, but %v", col)
+	}
+	for i := 0; i < 10; i++ {
+		if col, ok := table.Columns.matchAdhoc("user__count"); ok {
+			t.Fatalf("user__count: expected no column as ambiguous, but %s", col.name)
+		}
+	}
+}
+
+//Fake query returning the same columns and rows on every group
+func fakeResult(dbs []*fakeDb, cols []string, rows ...[]driver.Value) {
+	for _, db := range dbs {
+		db.query = func(string, []driver.Value) ([]string, [][]driver.Value, error) {
+			return cols, rows, nil
+		}
+	}
+}
+
+func TestFindAdhoc(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 1)
+	fakeResult(dbs, []string{"City", "total_amount", "User_Name"}, []driver.Value{"sz", 1.5, "a"})
+	s := engine.StartSession()
+	defer engine.EndSession(s)
+
+	var stats []*cityStat
+	if err := s.Query("select City, sum(Amount) as total_amount from T_Order group by City").Find(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].City != "sz" || stats[0].TotalAmount != 1.5 {
+		t.Errorf("Find() of raw query = %+v", stats)
+	}
+	//columns of generated select are matched exactly
+	var users []*genUser
+	if err := s.Where("Age>?", 18).Find(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].UserName != "" {
+		t.Errorf("User_Name is matched to UserName of generated select: %+v", users[0])
+	}
+}
+
+func TestFindMapsDistinct(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	fakeResult(dbs, []string{"City", "Total"},
+		[]driver.Value{[]byte("sz"), int64(1)}, []driver.Value{[]byte("bj"), int64(2)})
+	s := engine.StartSession()
+	defer engine.EndSession(s)
+
+	var maps []map[string]interface{}
+	if err := s.Query("select City, count(1) as Total from T_User group by City").FindMaps(&maps); err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) != 4 {
+		t.Errorf("FindMaps() merged %d rows of groups, want 4", len(maps))
+	}
+	maps = nil
+	if err := s.Table("T_User").Distinct("City,Total").Where("Age>?", 18).FindMaps(&maps); err != nil {
+		t.Fatal(err)
+	}
+	var cities []string
+	for _, m := range maps {
+		city, _ := m["City"].(string)
+		cities = append(cities, city)
+	}
+	sort.Strings(cities)
+	if !reflect.DeepEqual(cities, []string{"bj", "sz"}) {
+		t.Errorf("FindMaps() with distinct = %v, want [bj sz] with []byte converted to string", maps)
+	}
+	if !strings.Contains(dbs[0].log(), "select distinct City,Total from T_User where Age>?") {
+		t.Errorf("unexpected sql: %s", dbs[0].log())
+	}
+}
+
+func TestFindValuesDistinct(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	fakeResult(dbs, []string{"UserId"}, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+	s := engine.StartSession()
+	defer engine.EndSession(s)
+
+	var ids []int64
+	if err := s.Query("select UserId from T_User").FindValues(&ids); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 {
+		t.Errorf("FindValues() = %v, want rows of both groups", ids)
+	}
+	ids = nil
+	if err := s.Table("T_User").Distinct("").Where("Age>?", 18).Pluck("UserId", &ids); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("Pluck() with distinct = %v, want [1 2]", ids)
+	}
+}
@@ -5,25 +5,38 @@
 package shorm
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"reflect"
 	"strings"
+	"sync"
 )
 
 type Session struct {
+	cluster     *Cluster
 	group       *DbGroup
 	clauseList  sqlClauseList
 	sqlGen      SqlGenerator
 	logger      *log.Logger
 	engine      *Engine
-	hasShardKey bool //if specified shard key
-	isWrite     bool //True when insert,update,delete action, else false
-	forceMaster bool //force to execute sql against master node
+	hasShardKey bool              //if specified shard key
+	isWrite     bool              //True when insert,update,delete action, else false
+	forceMaster bool              //force to execute sql against master node
+	readToken   *ConsistencyToken //reads against groups in token will touch master node
+	written     *ConsistencyToken //records groups written by this session
+	tokenLock   sync.Mutex        //guards creating written token
+	err         error             //error occurred when building the operation, returned by next operation
+	parallel    bool              //processes groups concurrently in FindInBatches
 }
 
-// Copy 复制session
+// Copy 复制session, the copy must be ended by EndSession as well
 func (s *Session) Copy() *Session {
+	if s.cluster != nil {
+		s.cluster.acquire()
+	}
 	copy := &Session{
+		cluster:     s.cluster,
 		group:       s.group,
 		engine:      s.engine,
 		logger:      s.logger,
@@ -31,12 +44,15 @@ func (s *Session) Copy() *Session {
 		hasShardKey: s.hasShardKey,
 		isWrite:     false,
 		forceMaster: s.forceMaster,
+		readToken:   s.readToken,
 	}
 	for _, clause := range s.clauseList {
 		copy.clauseList = append(copy.clauseList, sqlClause{
 			op:     clause.op,
 			clause: clause.clause,
 			params: clause.params,
+			cond:   clause.cond,
+			join:   clause.join,
 		})
 	}
 	return copy
@@ -48,24 +64,93 @@ func (s *Session) reset() {
 	s.hasShardKey = false
 	s.isWrite = false
 	s.forceMaster = false
+	s.readToken = nil
+	s.err = nil
+	s.parallel = false
 }
 
 func (s *Session) ShardValue(value int64) *Session {
 	var has bool
-	if s.group, has = s.engine.cluster.findGroup(value); !has {
-		s.group, _ = s.engine.cluster.DefaultGroup()
+	if s.group, has = s.cluster.findGroup(value); !has {
+		s.err = s.useDefaultGroup()
 	} else {
 		s.hasShardKey = true
 	}
 	return s
 }
 
+//Routes next operation to default group
+func (s *Session) useDefaultGroup() error {
+	var err error
+	s.group, err = s.cluster.DefaultGroup()
+	return err
+}
+
+//Specifies the group to execute next operation
+func (s *Session) onGroup(group *DbGroup) *Session {
+	s.group = group
+	s.hasShardKey = true
+	return s
+}
+
 //Force to touch master db fo group
 func (s *Session) ForseMaster() *Session {
 	s.forceMaster = true
 	return s
 }
 
+// Consistent makes reads of next operation touch master node for groups
+// written within consistency window according to token.
+func (s *Session) Consistent(token *ConsistencyToken) *Session {
+	s.readToken = token
+	return s
+}
+
+// WithContext applies the consistency token stored in ctx, see ContextWithToken.
+func (s *Session) WithContext(ctx context.Context) *Session {
+	if token := TokenFromContext(ctx); token != nil {
+		s.readToken = token
+	}
+	return s
+}
+
+// ConsistencyToken returns the token that records all writes of this session,
+// the token is available until session is ended.
+func (s *Session) ConsistencyToken() *ConsistencyToken {
+	s.tokenLock.Lock()
+	defer s.tokenLock.Unlock()
+	if s.written == nil {
+		s.written = NewConsistencyToken()
+	}
+	return s.written
+}
+
+func (s *Session) markWrite(group *DbGroup) {
+	s.ConsistencyToken().markWrite(group)
+}
+
+//Get the node to execute read operation against group
+func (s *Session) readNode(group *DbGroup) (*DbNode, error) {
+	window := s.engine.consistencyWindow
+	if s.forceMaster || s.readToken.requireMaster(group, window) || s.written.requireMaster(group, window) {
+		return group.GetMaster()
+	}
+	return group.GetNode(), nil
+}
+
+//Gets the nodes to execute read operation against all groups
+func (s *Session) readNodes() ([]*DbNode, error) {
+	nodes := make([]*DbNode, 0, len(s.cluster.Groups))
+	for _, dg := range s.cluster.Groups {
+		node, err := s.readNode(dg)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
 func (s *Session) Query(query string, args ...interface{}) *Session {
 	subSql := sqlClause{
 		op:     opType_rawQuery,
@@ -97,6 +182,10 @@ func (s *Session) Table(tablename string) *Session {
 }
 
 func (s *Session) Where(clause string, args ...interface{}) *Session {
+	if hasSubQuery(args) {
+		s.clauseList = append(s.clauseList, sqlClause{op: opType_where, cond: rawSubCond{clause, args}})
+		return s
+	}
 	subSql := sqlClause{
 		op:     opType_where,
 		clause: clause,
@@ -109,6 +198,10 @@ func (s *Session) Where(clause string, args ...interface{}) *Session {
 }
 
 func (s *Session) And(clause string, args ...interface{}) *Session {
+	if hasSubQuery(args) {
+		s.clauseList = append(s.clauseList, sqlClause{op: opType_and, cond: rawSubCond{clause, args}})
+		return s
+	}
 	subSql := sqlClause{
 		op:     opType_and,
 		clause: clause,
@@ -121,6 +214,10 @@ func (s *Session) And(clause string, args ...interface{}) *Session {
 }
 
 func (s *Session) Or(clause string, args ...interface{}) *Session {
+	if hasSubQuery(args) {
+		s.clauseList = append(s.clauseList, sqlClause{op: opType_or, cond: rawSubCond{clause, args}})
+		return s
+	}
 	subSql := sqlClause{
 		op:     opType_or,
 		clause: clause,
@@ -133,6 +230,11 @@ func (s *Session) Or(clause string, args ...interface{}) *Session {
 }
 
 func (s *Session) In(colName string, args ...interface{}) *Session {
+	if len(args) == 1 {
+		if sub, ok := args[0].(*SubQuery); ok {
+			return s.WhereCond(In(colName, sub))
+		}
+	}
 	subSql := sqlClause{
 		op:     opType_in,
 		clause: colName,
@@ -220,6 +322,13 @@ func (s *Session) Cols(cols string) *Session {
 	return s
 }
 
+// Distinct equals < select distinct cols >, all selected columns if cols is empty.
+// Results merged from all groups are de-duplicated, Count ignores it.
+func (s *Session) Distinct(cols string) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_distinct, clause: cols})
+	return s
+}
+
 func (s *Session) Omit(cols string) *Session {
 	subSql := sqlClause{
 		op:     opType_omit,
@@ -233,3 +342,37 @@ func (s *Session) UnlockTable() *Session {
 	s.clauseList = append(s.clauseList, sqlClause{op: opType_unlockTable})
 	return s
 }
+
+// ForUpdate locks selected rows for update until transaction ends,
+// generates "for update" or "with(updlock,rowlock)" on SQL Server. It only works in transaction.
+func (s *Session) ForUpdate() *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_lock, clause: lock_update})
+	return s
+}
+
+// ForShare locks selected rows in share mode until transaction ends,
+// generates "for share" or "with(holdlock,rowlock)" on SQL Server. It only works in transaction.
+func (s *Session) ForShare() *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_lock, clause: lock_share})
+	return s
+}
+
+// SkipLocked skips the rows locked by others, generates "skip locked" or "readpast" on SQL Server
+func (s *Session) SkipLocked() *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_lock, clause: lock_skipLocked})
+	return s
+}
+
+// NoWait fails immediately if rows are locked by others
+func (s *Session) NoWait() *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_lock, clause: lock_nowait})
+	return s
+}
+
+//Row lock is released as soon as the statement ends if it is not in transaction
+func (s *Session) checkRowLock() error {
+	if mode, _ := s.clauseList.rowLock(); mode != "" {
+		return fmt.Errorf("row lock(for %s) can only be used in transaction", mode)
+	}
+	return nil
+}
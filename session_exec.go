@@ -22,6 +22,14 @@ type SqlResult struct {
 	err        error
 }
 
+//sqlExecutor executes sql statements, implemented by *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
 type temp struct {
 	values []interface{}
 	sqls   []string
@@ -29,7 +37,7 @@ type temp struct {
 }
 
 func (s *Session) getTableAndValue(model interface{}) (table *TableMetadata, value reflect.Value, err error) {
-	table, err = getTableMeta(model)
+	table, err = s.getTable(model)
 	if err != nil {
 		return
 	}
@@ -66,12 +74,16 @@ func (s *Session) genMultiInsertSql(table *TableMetadata, sliceValue reflect.Val
 
 func (s *Session) insertSlice2(table *TableMetadata, slice reflect.Value) (int64, error) {
 	sqlStr, args := s.genMultiInsertSql(table, slice)
-	node, _ := s.group.GetMaster()
+	node, err := s.group.GetMaster()
+	if err != nil {
+		return 0, err
+	}
 	s.logger.Printf("sql:%s\r\n args:%v\r\n", sqlStr, args)
 	result, err := node.Db.Exec(sqlStr, args...)
 	if err != nil {
 		return 0, err
 	}
+	s.markWrite(s.group)
 	return result.RowsAffected()
 }
 
@@ -80,6 +92,9 @@ func (s *Session) insertSlice2(table *TableMetadata, slice reflect.Value) (int64
 // but will guarantee the data lines in same db node are in db transaction
 func (s *Session) InsertSlice(slicePtr interface{}) (*SqlResult, error) {
 	defer s.reset()
+	if s.err != nil {
+		return nil, s.err
+	}
 	slice := reflect.Indirect(reflect.ValueOf(slicePtr))
 	if slice.Kind() != reflect.Slice {
 		return nil, fmt.Errorf("slicePtr must be a pointer to slice")
@@ -99,8 +114,10 @@ func (s *Session) InsertSlice(slicePtr interface{}) (*SqlResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	if !s.hasShardKey && s.engine.cluster.has1DbGroup() {
-		s.group, _ = s.engine.cluster.DefaultGroup()
+	if !s.hasShardKey && s.cluster.has1DbGroup() {
+		if err = s.useDefaultGroup(); err != nil {
+			return nil, err
+		}
 	}
 	if s.group != nil {
 		var count int64
@@ -126,8 +143,7 @@ func (s *Session) InsertSlice(slicePtr interface{}) (*SqlResult, error) {
 				if shardField.Type().Kind() == reflect.Ptr {
 					shardField = shardField.Elem()
 				}
-				shardValue := shardField.Interface()
-				switch v := shardValue.(type) {
+				switch v := shardField.Interface().(type) {
 				case int, int32, int64, uint, uint32, uint64:
 					shardValue, _ = strconv.ParseInt(fmt.Sprintf("%v", v), 10, 64)
 				}
@@ -136,12 +152,12 @@ func (s *Session) InsertSlice(slicePtr interface{}) (*SqlResult, error) {
 		var group *DbGroup
 		var has bool
 		if shardValue > 0 {
-			group, has = s.engine.cluster.findGroup(shardValue)
-			if !has {
-				group, _ = s.engine.cluster.DefaultGroup()
+			group, has = s.cluster.findGroup(shardValue)
+		}
+		if !has {
+			if group, err = s.cluster.DefaultGroup(); err != nil {
+				return nil, err
 			}
-		} else {
-			group, _ = s.engine.cluster.DefaultGroup()
 		}
 		if elementValue.Type().Kind() == reflect.Ptr {
 			elementValue = elementValue.Elem()
@@ -162,21 +178,29 @@ func (s *Session) InsertSlice(slicePtr interface{}) (*SqlResult, error) {
 
 	result := &SqlResult{}
 	ch_result := make(chan SqlResult)
+	written := s.ConsistencyToken()
 	wait := &sync.WaitGroup{}
 	for k, v := range shardGroup {
 		wait.Add(1)
 		go func(group *DbGroup, t *temp) {
-			node, _ := group.GetMaster()
-			sqlstr := strings.Join(v.sqls, ";")
-			s.logger.Printf("sql:%s\r\n args:%v\r\n", sqlstr, t.args)
-			s.logger.Printf("exec sql againt db node %s\r\n", node.Name)
-			_, err = node.Db.Exec(sqlstr, t.args...)
 			r := SqlResult{}
+			node, err := group.GetMaster()
 			if err != nil {
 				r.FailedData = t.values
-				r.err = fmt.Errorf("Group: %s, Node:%s, error:%v", group.Name, node.Name, err)
+				r.err = err
+				ch_result <- r
+				wait.Done()
+				return
+			}
+			sqlstr := strings.Join(t.sqls, ";")
+			s.logger.Printf("sql:%s\r\n args:%v\r\n", sqlstr, t.args)
+			s.logger.Printf("exec sql againt db node %s\r\n", node.Name)
+			if _, err = node.Db.Exec(sqlstr, t.args...); err != nil {
+				r.FailedData = t.values
+				r.err = &ShardError{Group: group.Name, Node: node.Name, Err: err}
 			} else {
 				r.Success = len(t.values)
+				written.markWrite(group)
 			}
 			ch_result <- r
 			wait.Done()
@@ -186,11 +210,18 @@ func (s *Session) InsertSlice(slicePtr interface{}) (*SqlResult, error) {
 		wait.Wait()
 		close(ch_result)
 	}()
+	var errs ShardErrors
 	for r := range ch_result {
 		result.Success += r.Success
 		result.FailedData = append(result.FailedData, r.FailedData...)
+		if r.err != nil {
+			errs = append(errs, toShardError(r.err))
+		}
 	}
-	return result, err
+	if len(errs) > 0 {
+		return result, errs
+	}
+	return result, nil
 }
 
 //InsertMulti equivalent to foreach to call method Insert(model interface{})
@@ -207,17 +238,17 @@ func (s *Session) InsertMulti(models ...interface{}) (int64, error) {
 	return count, nil
 }
 
-func (s *Session) innerExec(model interface{}, value reflect.Value, table *TableMetadata,
-	sqlStr string, args []interface{}) (sql.Result, error) {
+//Locates db group according to sharding value of model if not specified
+func (s *Session) locateGroup(model interface{}, value reflect.Value, table *TableMetadata) error {
 	if !s.hasShardKey {
-		if s.engine.cluster.has1DbGroup() {
-			s.group, _ = s.engine.cluster.DefaultGroup()
+		if s.cluster.has1DbGroup() {
+			return s.useDefaultGroup()
 		} else {
 			if table.IsShardinger {
-				s.ShardValue(model.(Shardinger).GetShardValue())
+				return s.ShardValue(model.(Shardinger).GetShardValue()).err
 			} else {
 				if table.ShardColumn == nil {
-					s.group, _ = s.engine.cluster.DefaultGroup()
+					return s.useDefaultGroup()
 				} else {
 					shardField := value.FieldByIndex(table.ShardColumn.fieldIndex)
 					if shardField.Type().Kind() == reflect.Ptr {
@@ -227,22 +258,40 @@ func (s *Session) innerExec(model interface{}, value reflect.Value, table *Table
 					switch v := shardValue.(type) {
 					case int, int32, int64, uint, uint32, uint64:
 						number, _ := strconv.ParseInt(fmt.Sprintf("%v", v), 10, 64)
-						s.ShardValue(number)
+						return s.ShardValue(number).err
 					default:
-						s.group, _ = s.engine.cluster.DefaultGroup()
+						return s.useDefaultGroup()
 					}
 				}
 			}
 		}
 	}
-	node, _ := s.group.GetMaster()
+	return nil
+}
+
+func (s *Session) innerExec(model interface{}, value reflect.Value, table *TableMetadata,
+	sqlStr string, args []interface{}) (sql.Result, error) {
+	if err := s.locateGroup(model, value, table); err != nil {
+		return nil, err
+	}
+	node, err := s.group.GetMaster()
+	if err != nil {
+		return nil, err
+	}
 	s.logger.Printf("exec sql against node %s", node.Name)
-	return node.Db.Exec(sqlStr, args...)
+	result, err := node.Db.Exec(sqlStr, args...)
+	if err == nil {
+		s.markWrite(s.group)
+	}
+	return result, err
 }
 
 //Insert data to db
 func (s *Session) Insert(model interface{}) (int64, error) {
 	defer s.reset()
+	if s.err != nil {
+		return 0, s.err
+	}
 	table, value, err := s.getTableAndValue(model)
 	if err != nil {
 		return 0, err
@@ -273,7 +322,7 @@ func (s *Session) Insert(model interface{}) (int64, error) {
 	return result.RowsAffected()
 }
 
-func (s *Session) insertWithTx(tx *sql.Tx, model interface{}) error {
+func (s *Session) insertWithTx(tx sqlExecutor, model interface{}) error {
 	defer s.reset()
 	table, value, err := s.getTableAndValue(model)
 	if err != nil {
@@ -286,6 +335,7 @@ func (s *Session) insertWithTx(tx *sql.Tx, model interface{}) error {
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 	var result sql.Result
 	if result, err = stmt.Exec(args...); err != nil {
 		return err
@@ -304,7 +354,7 @@ func (s *Session) insertWithTx(tx *sql.Tx, model interface{}) error {
 	return nil
 }
 
-func (s *Session) insertSliceWithTx(tx *sql.Tx, slicePtr interface{}) error {
+func (s *Session) insertSliceWithTx(tx sqlExecutor, slicePtr interface{}) error {
 	defer s.reset()
 	slice := reflect.Indirect(reflect.ValueOf(slicePtr))
 	if slice.Kind() != reflect.Slice {
@@ -333,6 +383,9 @@ func (s *Session) insertSliceWithTx(tx *sql.Tx, slicePtr interface{}) error {
 
 func (s *Session) Update(model interface{}) (int64, error) {
 	defer s.reset()
+	if s.err != nil {
+		return 0, s.err
+	}
 	table, value, err := s.getTableAndValue(model)
 	if err != nil {
 		return 0, err
@@ -340,24 +393,30 @@ func (s *Session) Update(model interface{}) (int64, error) {
 	sqlStr, args := s.sqlGen.GenUpdate(value, table, s.clauseList)
 	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
 	if !strings.Contains(sqlStr, "where") {
-		return 0, fmt.Errorf("'%s',UPDATE statement has no condition, DANGEROUS!", sqlStr)
+		return 0, fmt.Errorf("'%s',%w", sqlStr, ErrNoCondition)
 	}
 	var result sql.Result
-	if !s.hasShardKey && s.engine.cluster.has1DbGroup() {
-		s.group, _ = s.engine.cluster.DefaultGroup()
+	if !s.hasShardKey && s.cluster.has1DbGroup() {
+		if err = s.useDefaultGroup(); err != nil {
+			return 0, err
+		}
 	}
 	if s.group != nil {
-		node, _ := s.group.GetMaster()
+		node, err := s.group.GetMaster()
+		if err != nil {
+			return 0, err
+		}
 		if result, err = node.Db.Exec(sqlStr, args...); err != nil {
 			return 0, err
 		}
+		s.markWrite(s.group)
 		return result.RowsAffected()
 	}
 
 	return s.execSqlOnAllGroups(sqlStr, args)
 }
 
-func (s *Session) updateWithTx(tx *sql.Tx, model interface{}) error {
+func (s *Session) updateWithTx(tx sqlExecutor, model interface{}) error {
 	defer s.reset()
 	table, value, err := s.getTableAndValue(model)
 	if err != nil {
@@ -366,14 +425,14 @@ func (s *Session) updateWithTx(tx *sql.Tx, model interface{}) error {
 	sqlStr, args := s.sqlGen.GenUpdate(value, table, s.clauseList)
 	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
 	if !strings.Contains(sqlStr, "where") {
-		return fmt.Errorf("'%s',UPDATE statement has no condition, DANGEROUS!", sqlStr)
+		return fmt.Errorf("'%s',%w", sqlStr, ErrNoCondition)
 	}
 	result, err := tx.Exec(sqlStr, args...)
 	if err != nil {
 		return err
 	}
 	if rows, _ := result.RowsAffected(); rows <= 0 {
-		return fmt.Errorf("No rows affected")
+		return ErrNoRowsAffected
 	}
 	return nil
 }
@@ -382,25 +441,34 @@ func (s *Session) updateWithTx(tx *sql.Tx, model interface{}) error {
 // If don't specify sharding value, the delete sql will be exeucted on master nodes of all groups.
 func (s *Session) Delete(model interface{}) (int64, error) {
 	defer s.reset()
-	table, err := getTableMeta(model)
+	if s.err != nil {
+		return 0, s.err
+	}
+	table, err := s.getTable(model)
 	if err != nil {
 		return 0, err
 	}
 	sqlStr, args := s.sqlGen.GenDelete(table, s.clauseList)
 	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
 	if !strings.Contains(sqlStr, "where") {
-		return 0, fmt.Errorf("'%s',DELETE statement has no condition, DANGEROUS!", sqlStr)
+		return 0, fmt.Errorf("'%s',%w", sqlStr, ErrNoCondition)
 	}
 	var result sql.Result
-	if !s.hasShardKey && s.engine.cluster.has1DbGroup() {
-		s.group, _ = s.engine.cluster.DefaultGroup()
+	if !s.hasShardKey && s.cluster.has1DbGroup() {
+		if err = s.useDefaultGroup(); err != nil {
+			return 0, err
+		}
 	}
 	if s.group != nil {
-		node, _ := s.group.GetMaster()
+		node, err := s.group.GetMaster()
+		if err != nil {
+			return 0, err
+		}
 		s.logger.Printf("exec sql against node %s", node.Name)
 		if result, err = node.Db.Exec(sqlStr, args...); err != nil {
 			return 0, err
 		}
+		s.markWrite(s.group)
 		return result.RowsAffected()
 	}
 	return s.execSqlOnAllGroups(sqlStr, args)
@@ -412,21 +480,28 @@ type tempResult struct {
 }
 
 func (s *Session) execSqlOnAllGroups(sqlStr string, args []interface{}) (int64, error) {
-	var err error
 	ch_result := make(chan tempResult)
+	written := s.ConsistencyToken()
 	wait := &sync.WaitGroup{}
-	for _, g := range s.engine.cluster.Groups {
+	for _, g := range s.cluster.Groups {
 		wait.Add(1)
 		go func(group *DbGroup) {
-			node, _ := group.GetMaster()
+			defer wait.Done()
 			r := tempResult{}
+			node, err := group.GetMaster()
+			if err != nil {
+				r.err = err
+				ch_result <- r
+				return
+			}
 			s.logger.Printf("exec sql against node %s", node.Name)
 			r.result, r.err = node.Db.Exec(sqlStr, args...)
 			if r.err != nil {
-				r.err = fmt.Errorf("Group: %s, Node: %s, error:%v", group.Name, node.Name, r.err)
+				r.err = &ShardError{Group: group.Name, Node: node.Name, Err: r.err}
+			} else {
+				written.markWrite(group)
 			}
 			ch_result <- r
-			wait.Done()
 		}(g)
 	}
 	go func() {
@@ -434,27 +509,31 @@ func (s *Session) execSqlOnAllGroups(sqlStr string, args []interface{}) (int64,
 		close(ch_result)
 	}()
 	count := int64(0)
+	var errs ShardErrors
 	for r := range ch_result {
 		if r.err != nil {
-			err = fmt.Errorf("%v;%v", err, r.err)
+			errs = append(errs, toShardError(r.err))
 		} else {
 			n, _ := r.result.RowsAffected()
 			count += n
 		}
 	}
-	return count, err
+	if len(errs) > 0 {
+		return count, errs
+	}
+	return count, nil
 }
 
-func (s *Session) deleteWithTx(tx *sql.Tx, model interface{}) error {
+func (s *Session) deleteWithTx(tx sqlExecutor, model interface{}) error {
 	defer s.reset()
-	table, err := getTableMeta(model)
+	table, err := s.getTable(model)
 	if err != nil {
 		return err
 	}
 	sqlStr, args := s.sqlGen.GenDelete(table, s.clauseList)
 	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
 	if !strings.Contains(sqlStr, "where") {
-		return fmt.Errorf("'%s',DELETE statement has no condition, DANGEROUS!", sqlStr)
+		return fmt.Errorf("'%s',%w", sqlStr, ErrNoCondition)
 	}
 	_, err = tx.Exec(sqlStr, args...)
 	return err
@@ -7,6 +7,7 @@
 package shorm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -18,8 +19,16 @@ import (
 // Scalar 获取一个值
 func (s *Session) Scalar(sql string, v interface{}, args ...interface{}) error {
 	defer s.reset()
-	s.group, _ = s.engine.cluster.DefaultGroup()
-	node := s.group.GetNode()
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.useDefaultGroup(); err != nil {
+		return err
+	}
+	node, err := s.readNode(s.group)
+	if err != nil {
+		return err
+	}
 	s.logger.Printf("sql:%s, args:%#v\r\n", sql, args)
 	row := node.Db.QueryRow(sql, args...)
 	return row.Scan(v)
@@ -27,7 +36,13 @@ func (s *Session) Scalar(sql string, v interface{}, args ...interface{}) error {
 
 func (s *Session) Count(model interface{}) (int64, error) {
 	defer s.reset()
-	table, err := getTableMeta(model)
+	if s.err != nil {
+		return 0, s.err
+	}
+	if err := s.checkRowLock(); err != nil {
+		return 0, err
+	}
+	table, err := s.getTable(model)
 	if err != nil {
 		return 0, err
 	}
@@ -36,24 +51,22 @@ func (s *Session) Count(model interface{}) (int64, error) {
 	if s.hasShardKey {
 		return s.innerCountWithShardkey(sqlStr, args...)
 	}
-	if s.engine.cluster.has1DbGroup() {
-		s.group, _ = s.engine.cluster.DefaultGroup()
+	if s.cluster.has1DbGroup() {
+		if err = s.useDefaultGroup(); err != nil {
+			return 0, err
+		}
 		return s.innerCountWithShardkey(sqlStr, args...)
 	}
-
+	if err = s.checkJoin(table); err != nil {
+		return 0, err
+	}
 	return s.innerCountWithoutShardkey(sqlStr, args...)
 }
 
 func (s *Session) innerCountWithShardkey(sqlStr string, args ...interface{}) (int64, error) {
-	var node *DbNode
-	var err error
-	if s.forceMaster {
-		node, err = s.group.GetMaster()
-		if err != nil {
-			return 0, err
-		}
-	} else {
-		node = s.group.GetNode()
+	node, err := s.readNode(s.group)
+	if err != nil {
+		return 0, err
 	}
 	s.logger.Println("Node name:", node.Name)
 	row := node.Db.QueryRow(sqlStr, args...)
@@ -63,45 +76,56 @@ func (s *Session) innerCountWithShardkey(sqlStr string, args ...interface{}) (in
 }
 
 func (s *Session) innerCountWithoutShardkey(sqlStr string, args ...interface{}) (int64, error) {
-	ch_row := make(chan int64, s.engine.cluster.RealGroups)
-	for _, dg := range s.engine.cluster.Groups {
-		var node *DbNode
-		if s.forceMaster {
-			node, _ = dg.GetMaster()
-		} else {
-			node = dg.GetNode()
-		}
+	nodes, err := s.readNodes()
+	if err != nil {
+		return 0, err
+	}
+	type result struct {
+		count int64
+		err   *ShardError
+	}
+	ch_row := make(chan result, len(nodes))
+	for i, node := range nodes {
+		group, node := s.cluster.Groups[i], node
 		go func() {
 			s.logger.Println("execute sql query againt db:", node.Name)
-			row := node.Db.QueryRow(sqlStr, args...)
-			var result int64
-			row.Scan(&result)
-			ch_row <- result
+			var r result
+			if err := node.Db.QueryRow(sqlStr, args...).Scan(&r.count); err != nil {
+				r.err = &ShardError{Group: group.Name, Node: node.Name, Err: err}
+			}
+			ch_row <- r
 		}()
 	}
 	var retResult int64
-	count := 0
-Loop:
-	for {
+	var errs ShardErrors
+	timeout := time.After(time.Second * 30)
+	for range nodes {
 		select {
-		case rslt := <-ch_row:
-			retResult += rslt
-			count++
-			if count >= s.engine.cluster.RealGroups {
-				break Loop
+		case r := <-ch_row:
+			retResult += r.count
+			if r.err != nil {
+				errs = append(errs, r.err)
 			}
-			continue Loop
-		case <-time.After(time.Second * 30):
-			break Loop
+		case <-timeout:
+			return 0, fmt.Errorf("query timeout")
 		}
 	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
 	return retResult, nil
 }
 
 //Retrieve one record
 func (s *Session) Get(model interface{}) (bool, error) {
 	defer s.reset()
-	table, err := getTableMeta(model)
+	if s.err != nil {
+		return false, s.err
+	}
+	if err := s.checkRowLock(); err != nil {
+		return false, err
+	}
+	table, err := s.getTable(model)
 	if err != nil {
 		return false, err
 	}
@@ -112,10 +136,12 @@ func (s *Session) Get(model interface{}) (bool, error) {
 	if s.hasShardKey {
 		rows, err = s.innerGetWithShardKey(sqlStr, args...)
 	} else {
-		if s.engine.cluster.has1DbGroup() {
-			s.group, _ = s.engine.cluster.DefaultGroup()
+		if s.cluster.has1DbGroup() {
+			if err = s.useDefaultGroup(); err != nil {
+				return false, err
+			}
 			rows, err = s.innerGetWithShardKey(sqlStr, args...)
-		} else {
+		} else if err = s.checkJoin(table); err == nil {
 			rows, err = s.innerGetWithoutShardKey(sqlStr, args...)
 		}
 	}
@@ -123,7 +149,7 @@ func (s *Session) Get(model interface{}) (bool, error) {
 		return false, err
 	}
 	var valuePair valuePairList
-	if valuePair, err = row2Slice(rows, table.Columns); err != nil {
+	if valuePair, err = row2Slice(rows, table.Columns, s.clauseList.has(opType_rawQuery)); err != nil {
 		return false, err
 	}
 	if err = toStruct(valuePair, model); err != nil {
@@ -133,19 +159,18 @@ func (s *Session) Get(model interface{}) (bool, error) {
 }
 
 func (s *Session) innerGetWithShardKey(sqlStr string, args ...interface{}) (*sql.Rows, error) {
-	var node *DbNode
-	var err error
-	if s.forceMaster {
-		node, err = s.group.GetMaster()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		node = s.group.GetNode()
+	node, err := s.readNode(s.group)
+	if err != nil {
+		return nil, err
 	}
 	s.logger.Println("Node name:", node.Name)
-	var rows *sql.Rows
-	rows, err = node.Db.Query(sqlStr, args...)
+	return queryRows(node.Db, sqlStr, args...)
+}
+
+//Executes query, returns sql.ErrNoRows if no rows in result,
+//otherwise rows.Next() has been called.
+func queryRows(db sqlExecutor, sqlStr string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := db.Query(sqlStr, args...)
 	if err != nil {
 		if rows != nil {
 			rows.Close()
@@ -153,64 +178,49 @@ func (s *Session) innerGetWithShardKey(sqlStr string, args ...interface{}) (*sql
 		return nil, err
 	}
 	if !rows.Next() {
+		err = rows.Err()
 		rows.Close()
+		if err != nil {
+			return nil, err
+		}
 		return nil, sql.ErrNoRows
 	}
 	return rows, nil
 }
 
 func (s *Session) innerGetWithoutShardKey(sqlstr string, args ...interface{}) (*sql.Rows, error) {
-	ch_row := make(chan *sql.Rows, s.engine.cluster.RealGroups)
-	for _, dg := range s.engine.cluster.Groups {
-		var node *DbNode
-		if s.forceMaster {
-			node, _ = dg.GetMaster()
-		} else {
-			node = dg.GetNode()
-		}
-		go func() {
-			s.logger.Println("execute sql query againt db:", node.Name)
-			if rows, err := node.Db.Query(sqlstr, args...); err != nil {
-				if rows != nil {
-					rows.Close()
-				}
-				ch_row <- nil
-			} else {
-				if rows.Next() {
-					ch_row <- rows
-				} else {
-					rows.Close()
-					ch_row <- nil
-				}
-
-			}
-		}()
+	nodes, err := s.readNodes()
+	if err != nil {
+		return nil, err
 	}
-	count := 0
-Loop:
-	for {
+	ch_row := s.queryGroups(nodes, sqlstr, args...)
+	var errs ShardErrors
+	timeout := time.After(time.Second * 30)
+	for range nodes {
 		select {
-		case row := <-ch_row:
-			if row != nil {
-				return row, nil
+		case r := <-ch_row:
+			if r.rows != nil {
+				go discardRows(ch_row)
+				return r.rows, nil
 			}
-			count++
-			if count >= s.engine.cluster.RealGroups {
-				return nil, sql.ErrNoRows
+			if r.err != nil {
+				errs = append(errs, r.shardError(r.err))
 			}
-			continue Loop
-		case <-time.After(time.Second * 30):
+		case <-timeout:
+			go discardRows(ch_row)
 			return nil, fmt.Errorf("query timeout")
 		}
 	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return nil, sql.ErrNoRows
 }
 
-//Find implements querying multiple recrods according to search criteria
-func (s *Session) Find(slicePtr interface{}) error {
-	defer s.reset()
+func getSliceTableMeta(slicePtr interface{}) (*TableMetadata, error) {
 	slice := reflect.Indirect(reflect.ValueOf(slicePtr))
 	if slice.Kind() != reflect.Slice {
-		return fmt.Errorf("slicePtr must be a pointer to slice")
+		return nil, fmt.Errorf("slicePtr must be a pointer to slice")
 	}
 	elementType := slice.Type().Elem()
 
@@ -218,35 +228,73 @@ func (s *Session) Find(slicePtr interface{}) error {
 		elementType = elementType.Elem()
 	}
 	if elementType.Kind() != reflect.Struct {
-		return fmt.Errorf("element type must be struct")
+		return nil, fmt.Errorf("element type must be struct")
 	}
-	table, err := getTableMeta(reflect.New(elementType).Interface())
+	return getTableMeta(reflect.New(elementType).Interface())
+}
+
+//Checks if query has neither condition nor limit, raw query is not checked
+func (s *Session) checkTableScan(sqlstr string) error {
+	if s.clauseList.has(opType_rawQuery) {
+		return nil
+	}
+	if !(strings.Contains(sqlstr, "where") || strings.Contains(sqlstr, "limit")) {
+		return fmt.Errorf("'%s',%w", sqlstr, ErrTableScan)
+	}
+	return nil
+}
+
+//Find implements querying multiple recrods according to search criteria
+func (s *Session) Find(slicePtr interface{}) error {
+	defer s.reset()
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.checkRowLock(); err != nil {
+		return err
+	}
+	table, err := s.getSliceTable(slicePtr)
 	if err != nil {
 		return err
 	}
 
 	sqlstr, args := s.sqlGen.GenSelect(table, s.clauseList)
 	s.logger.Printf("sql:%s, args:%#v\r\n", sqlstr, args)
-	if !(strings.Contains(sqlstr, "where") || strings.Contains(sqlstr, "limit")) {
-		return fmt.Errorf("'%s',table scan, DANGEROUS!", sqlstr)
+	if err = s.checkTableScan(sqlstr); err != nil {
+		return err
 	}
 	var valuePair valuePairList
-	if !(s.hasShardKey || s.engine.cluster.has1DbGroup()) {
-		row_ch := s.innerFindWithoutShardKey(sqlstr, args...)
-		for row := range row_ch {
-			if row == nil {
-				continue
-			}
-			if valueList, err2 := row2Slice(row, table.Columns); err2 != nil {
-				continue
-			} else {
+	if !(s.hasShardKey || s.cluster.has1DbGroup()) {
+		if err = s.checkJoin(table); err != nil {
+			return err
+		}
+		row_ch, err := s.innerFindWithoutShardKey(sqlstr, args...)
+		if err != nil {
+			return err
+		}
+		var errs ShardErrors
+		for r := range row_ch {
+			if r.rows != nil {
+				var valueList valuePairList
+				valueList, r.err = row2Slice(r.rows, table.Columns, s.clauseList.has(opType_rawQuery))
 				valuePair = append(valuePair, valueList...)
 			}
+			if r.err != nil {
+				errs = append(errs, r.shardError(r.err))
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		if s.clauseList.has(opType_distinct) {
+			valuePair = valuePair.distinct()
 		}
 	} else {
 		var rows *sql.Rows
 		if !s.hasShardKey {
-			s.group, _ = s.engine.cluster.DefaultGroup()
+			if err = s.useDefaultGroup(); err != nil {
+				return err
+			}
 		}
 		rows, err = s.innerGetWithShardKey(sqlstr, args...)
 		if err == sql.ErrNoRows {
@@ -254,7 +302,7 @@ func (s *Session) Find(slicePtr interface{}) error {
 		} else if err != nil {
 			return err
 		}
-		if valuePair, err = row2Slice(rows, table.Columns); err != nil {
+		if valuePair, err = row2Slice(rows, table.Columns, s.clauseList.has(opType_rawQuery)); err != nil {
 			return err
 		}
 	}
@@ -262,41 +310,434 @@ func (s *Session) Find(slicePtr interface{}) error {
 	return toStructList(valuePair, slicePtr)
 }
 
+//Rows of group queried by queryGroups, rows.Next() has been called,
+//rows is nil if query returns no rows or error
+type shardRows struct {
+	group *DbGroup
+	node  *DbNode
+	rows  *sql.Rows
+	err   error
+}
+
+func (r shardRows) shardError(err error) *ShardError {
+	return &ShardError{Group: r.group.Name, Node: r.node.Name, Err: err}
+}
+
+//Closes rows of the groups not handled
+func discardRows(ch_row chan shardRows) {
+	for r := range ch_row {
+		if r.rows != nil {
+			r.rows.Close()
+		}
+	}
+}
+
 //Exec query against all db groups, and will merge all results as final output
-func (s *Session) innerFindWithoutShardKey(sqlstr string, args ...interface{}) chan *sql.Rows {
-	ch_row := make(chan *sql.Rows, s.engine.cluster.RealGroups)
+func (s *Session) innerFindWithoutShardKey(sqlstr string, args ...interface{}) (chan shardRows, error) {
+	nodes, err := s.readNodes()
+	if err != nil {
+		return nil, err
+	}
+	return s.queryGroups(nodes, sqlstr, args...), nil
+}
+
+//Queries nodes of all groups concurrently, the channel is closed after all groups return
+func (s *Session) queryGroups(nodes []*DbNode, sqlstr string, args ...interface{}) chan shardRows {
+	ch_row := make(chan shardRows, len(nodes))
 	wg := &sync.WaitGroup{}
-	for _, dg := range s.engine.cluster.Groups {
-		var node *DbNode
-		if s.forceMaster {
-			node, _ = dg.GetMaster()
-		} else {
-			node = dg.GetNode()
-		}
+	for i, node := range nodes {
 		wg.Add(1)
-		go func(dbNode *DbNode, ch chan *sql.Rows) {
+		go func(r shardRows) {
 			defer wg.Done()
-			s.logger.Println("execute sql query againt db:", dbNode.Name)
-			rows, err := node.Db.Query(sqlstr, args...)
-			if err != nil {
-				if rows != nil {
-					rows.Close()
-				}
-				ch <- nil
-			} else {
-				if rows.Next() {
-					ch <- rows
-				} else {
-					rows.Close()
-					ch <- nil
-				}
+			s.logger.Println("execute sql query againt db:", r.node.Name)
+			r.rows, r.err = queryRows(r.node.Db, sqlstr, args...)
+			if r.err == sql.ErrNoRows {
+				r.err = nil
 			}
-		}(node, ch_row)
+			ch_row <- r
+		}(shardRows{group: s.cluster.Groups[i], node: node})
 	}
-	go func(ch chan *sql.Rows) {
+	go func() {
 		wg.Wait()
-		close(ch)
-	}(ch_row)
-
+		close(ch_row)
+	}()
 	return ch_row
 }
+
+func (s *Session) scalarWithTx(tx sqlExecutor, sql string, v interface{}, args ...interface{}) error {
+	defer s.reset()
+	if s.err != nil {
+		return s.err
+	}
+	s.logger.Printf("sql:%s, args:%#v\r\n", sql, args)
+	return tx.QueryRow(sql, args...).Scan(v)
+}
+
+func (s *Session) countWithTx(tx sqlExecutor, model interface{}) (int64, error) {
+	defer s.reset()
+	//count sql does not lock rows, which must not be ignored silently
+	if mode, _ := s.clauseList.rowLock(); mode != "" {
+		return 0, fmt.Errorf("row lock(for %s) can not be used with count", mode)
+	}
+	table, err := s.getTable(model)
+	if err != nil {
+		return 0, err
+	}
+	sqlStr, args := s.sqlGen.GenCount(table, s.clauseList)
+	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
+	var result int64
+	err = tx.QueryRow(sqlStr, args...).Scan(&result)
+	return result, err
+}
+
+func (s *Session) getWithTx(tx sqlExecutor, model interface{}) (bool, error) {
+	defer s.reset()
+	table, err := s.getTable(model)
+	if err != nil {
+		return false, err
+	}
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_top, params: []interface{}{1}})
+	sqlStr, args := s.sqlGen.GenSelect(table, s.clauseList)
+	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
+	rows, err := queryRows(tx, sqlStr, args...)
+	if err != nil {
+		return false, err
+	}
+	var valuePair valuePairList
+	if valuePair, err = row2Slice(rows, table.Columns, s.clauseList.has(opType_rawQuery)); err != nil {
+		return false, err
+	}
+	if err = toStruct(valuePair, model); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Session) findWithTx(tx sqlExecutor, slicePtr interface{}) error {
+	defer s.reset()
+	table, err := s.getSliceTable(slicePtr)
+	if err != nil {
+		return err
+	}
+	sqlstr, args := s.sqlGen.GenSelect(table, s.clauseList)
+	s.logger.Printf("sql:%s, args:%#v\r\n", sqlstr, args)
+	if err = s.checkTableScan(sqlstr); err != nil {
+		return err
+	}
+	rows, err := queryRows(tx, sqlstr, args...)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	valuePair, err := row2Slice(rows, table.Columns, s.clauseList.has(opType_rawQuery))
+	if err != nil {
+		return err
+	}
+	return toStructList(valuePair, slicePtr)
+}
+
+//Generates sql selecting 1 of the first matched record
+func (s *Session) genExists(model interface{}) (*TableMetadata, string, []interface{}, error) {
+	table, err := s.getTable(model)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	s.clauseList = append(s.clauseList.without(opType_cols, opType_omit, opType_distinct, opType_orderby),
+		sqlClause{op: opType_cols, clause: "1"}, sqlClause{op: opType_top, params: []interface{}{1}})
+	sqlStr, args := s.sqlGen.GenSelect(table, s.clauseList)
+	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
+	return table, sqlStr, args, nil
+}
+
+//Checks if query returns any row
+func existsRow(ctx context.Context, db *sql.DB, sqlStr string, args ...interface{}) (bool, error) {
+	var one int
+	err := db.QueryRowContext(ctx, sqlStr, args...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Exists checks if any record matches the conditions, only 1 is selected instead of columns of model.
+// Without shard value, all groups are queried concurrently and the others are canceled
+// once any group returns a row.
+/*
+	Usage:
+		exists, err := session.Where("UserName=?", name).Exists(&User{})
+*/
+func (s *Session) Exists(model interface{}) (bool, error) {
+	defer s.reset()
+	if s.err != nil {
+		return false, s.err
+	}
+	if err := s.checkRowLock(); err != nil {
+		return false, err
+	}
+	table, sqlStr, args, err := s.genExists(model)
+	if err != nil {
+		return false, err
+	}
+	if !s.hasShardKey && !s.cluster.has1DbGroup() {
+		if err = s.checkJoin(table); err != nil {
+			return false, err
+		}
+		return s.innerExistsWithoutShardKey(sqlStr, args...)
+	}
+	if !s.hasShardKey {
+		if err = s.useDefaultGroup(); err != nil {
+			return false, err
+		}
+	}
+	node, err := s.readNode(s.group)
+	if err != nil {
+		return false, err
+	}
+	return existsRow(context.Background(), node.Db, sqlStr, args...)
+}
+
+func (s *Session) innerExistsWithoutShardKey(sqlStr string, args ...interface{}) (bool, error) {
+	nodes, err := s.readNodes()
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type result struct {
+		found bool
+		err   error
+	}
+	ch := make(chan result, len(nodes))
+	for i, node := range nodes {
+		group, node := s.cluster.Groups[i], node
+		go func() {
+			s.logger.Println("execute sql query againt db:", node.Name)
+			found, err := existsRow(ctx, node.Db, sqlStr, args...)
+			if err != nil {
+				err = &ShardError{Group: group.Name, Node: node.Name, Err: err}
+			}
+			ch <- result{found, err}
+		}()
+	}
+	var errs ShardErrors
+	for range nodes {
+		r := <-ch
+		if r.found {
+			return true, nil
+		}
+		if r.err != nil {
+			errs = append(errs, r.err.(*ShardError))
+		}
+	}
+	if len(errs) > 0 {
+		return false, errs
+	}
+	return false, nil
+}
+
+func (s *Session) existsWithTx(tx sqlExecutor, model interface{}) (bool, error) {
+	defer s.reset()
+	_, sqlStr, args, err := s.genExists(model)
+	if err != nil {
+		return false, err
+	}
+	var one int
+	err = tx.QueryRow(sqlStr, args...).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//Generates sql of raw query or the query against table specified by Table
+func (s *Session) genAdhoc() (string, []interface{}, error) {
+	if s.err != nil {
+		return "", nil, s.err
+	}
+	table := &TableMetadata{Columns: make(ColMetadataMap)}
+	if !s.clauseList.has(opType_rawQuery) {
+		if err := s.resolveAdhocTable(table); err != nil {
+			return "", nil, err
+		}
+	}
+	sqlStr, args := s.sqlGen.GenSelect(table, s.clauseList)
+	s.logger.Printf("sql:%s, args:%#v\r\n", sqlStr, args)
+	return sqlStr, args, s.checkTableScan(sqlStr)
+}
+
+//Resolves table specified by Table, all columns are selected if Cols not specified
+func (s *Session) resolveAdhocTable(table *TableMetadata) error {
+	for _, c := range s.clauseList {
+		if c.op == opType_table {
+			table.Name = c.clause
+		}
+	}
+	if table.Name == "" {
+		return fmt.Errorf("table must be specified by Table if not raw query")
+	}
+	selectAll := !s.clauseList.has(opType_cols)
+	for _, c := range s.clauseList {
+		if c.op == opType_distinct && c.clause != "" {
+			selectAll = false
+		}
+	}
+	if selectAll {
+		s.clauseList = append(s.clauseList, sqlClause{op: opType_cols, clause: "*"})
+	}
+	return s.resolveConds(table)
+}
+
+//Queries the group of shard value or all groups, rows of each node are handled one by one,
+//rows.Next() has been called and handle should close rows.
+func (s *Session) queryEach(sqlStr string, args []interface{}, handle func(rows *sql.Rows) error) error {
+	if s.hasShardKey || s.cluster.has1DbGroup() {
+		if !s.hasShardKey {
+			if err := s.useDefaultGroup(); err != nil {
+				return err
+			}
+		}
+		rows, err := s.innerGetWithShardKey(sqlStr, args...)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return handle(rows)
+	}
+	row_ch, err := s.innerFindWithoutShardKey(sqlStr, args...)
+	if err != nil {
+		return err
+	}
+	var errs ShardErrors
+	for r := range row_ch {
+		if r.rows != nil {
+			r.err = handle(r.rows)
+		}
+		if r.err != nil {
+			errs = append(errs, r.shardError(r.err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func queryEachWithTx(tx sqlExecutor, sqlStr string, args []interface{}, handle func(rows *sql.Rows) error) error {
+	rows, err := queryRows(tx, sqlStr, args...)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return handle(rows)
+}
+
+//Checks pointer to slice, returns the slice
+func sliceOf(slicePtr interface{}) (reflect.Value, error) {
+	slice := reflect.ValueOf(slicePtr)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return slice, fmt.Errorf("slicePtr must be a pointer to slice")
+	}
+	return slice.Elem(), nil
+}
+
+//Set of scanned values if results of all groups should be de-duplicated
+func (s *Session) distinctSet() map[string]bool {
+	if s.clauseList.has(opType_distinct) {
+		return make(map[string]bool)
+	}
+	return nil
+}
+
+// Pluck selects single column of table specified by Table into slice of the column type, see FindValues.
+// Results merged from all groups are de-duplicated if Distinct is specified.
+/*
+	Usage:
+		var names []string
+		err := session.Table("T_User").Where("Age>?", 18).Pluck("UserName", &names)
+*/
+func (s *Session) Pluck(col string, slicePtr interface{}) error {
+	s.clauseList = append(s.clauseList.without(opType_cols, opType_omit), sqlClause{op: opType_cols, clause: col})
+	return s.FindValues(slicePtr)
+}
+
+func (s *Session) pluckWithTx(tx sqlExecutor, col string, slicePtr interface{}) error {
+	s.clauseList = append(s.clauseList.without(opType_cols, opType_omit), sqlClause{op: opType_cols, clause: col})
+	return s.findValuesWithTx(tx, slicePtr)
+}
+
+// FindValues scans the first column of raw query or query against Table into slice of primitive type.
+/*
+	Usage:
+		var ids []int64
+		err := session.Query("select UserId from T_User where Age>?", 18).FindValues(&ids)
+*/
+func (s *Session) FindValues(slicePtr interface{}) error {
+	defer s.reset()
+	if err := s.checkRowLock(); err != nil {
+		return err
+	}
+	slice, err := sliceOf(slicePtr)
+	if err != nil {
+		return err
+	}
+	sqlStr, args, err := s.genAdhoc()
+	if err != nil {
+		return err
+	}
+	seen := s.distinctSet()
+	return s.queryEach(sqlStr, args, func(rows *sql.Rows) error {
+		return scanColumn(rows, slice, seen)
+	})
+}
+
+func (s *Session) findValuesWithTx(tx sqlExecutor, slicePtr interface{}) error {
+	defer s.reset()
+	slice, err := sliceOf(slicePtr)
+	if err != nil {
+		return err
+	}
+	sqlStr, args, err := s.genAdhoc()
+	if err != nil {
+		return err
+	}
+	return queryEachWithTx(tx, sqlStr, args, func(rows *sql.Rows) error {
+		return scanColumn(rows, slice, nil)
+	})
+}
+
+// FindMaps scans results of raw query or query against Table into maps of column name to value,
+// []byte value is converted to string.
+// Results merged from all groups are de-duplicated if Distinct is specified.
+/*
+	Usage:
+		var stats []map[string]interface{}
+		err := session.Query("select City, count(1) as Total from T_User group by City").FindMaps(&stats)
+*/
+func (s *Session) FindMaps(maps *[]map[string]interface{}) error {
+	defer s.reset()
+	if err := s.checkRowLock(); err != nil {
+		return err
+	}
+	sqlStr, args, err := s.genAdhoc()
+	if err != nil {
+		return err
+	}
+	seen := s.distinctSet()
+	return s.queryEach(sqlStr, args, func(rows *sql.Rows) error {
+		return scanMaps(rows, maps, seen)
+	})
+}
+
+func (s *Session) findMapsWithTx(tx sqlExecutor, maps *[]map[string]interface{}) error {
+	defer s.reset()
+	sqlStr, args, err := s.genAdhoc()
+	if err != nil {
+		return err
+	}
+	return queryEachWithTx(tx, sqlStr, args, func(rows *sql.Rows) error {
+		return scanMaps(rows, maps, nil)
+	})
+}
@@ -19,12 +19,18 @@ type opType int8
 
 const (
 	opType_rawQuery opType = iota + 1
+	opType_with
+	opType_withRecursive
+	opType_distinct
 	opType_limit
 	opType_top
 	opType_cols
 	opType_omit
 	opType_table
+	opType_alias
 	opType_unlockTable
+	opType_lock
+	opType_join
 	opType_id
 	opType_where
 	opType_in
@@ -33,6 +39,7 @@ const (
 	opType_between_or
 	opType_and
 	opType_or
+	opType_union
 	opType_orderby
 )
 
@@ -40,10 +47,66 @@ type sqlClause struct {
 	op     opType
 	clause string
 	params []interface{}
+	cond   Cond     //structured condition, rendered into clause and params by generator
+	join   *sqlJoin //joined table, clause and params are the join condition
 }
 
 type sqlClauseList []sqlClause
 
+// Row lock modes
+const (
+	lock_update     = "update"
+	lock_share      = "share"
+	lock_skipLocked = "skip locked"
+	lock_nowait     = "nowait"
+)
+
+//Gets row lock mode and wait policy
+func (list sqlClauseList) rowLock() (mode, wait string) {
+	for _, s := range list {
+		if s.op != opType_lock {
+			continue
+		}
+		switch s.clause {
+		case lock_update, lock_share:
+			mode = s.clause
+		default:
+			wait = s.clause
+		}
+	}
+	if mode == "" && wait != "" {
+		mode = lock_update
+	}
+	return
+}
+
+func (list sqlClauseList) has(op opType) bool {
+	for _, s := range list {
+		if s.op == op {
+			return true
+		}
+	}
+	return false
+}
+
+//Copies list without clauses of ops
+func (list sqlClauseList) without(ops ...opType) sqlClauseList {
+	result := make(sqlClauseList, 0, len(list))
+	for _, s := range list {
+		keep := true
+		for _, op := range ops {
+			if s.op == op {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 func (list sqlClauseList) Len() int {
 	return len(list)
 }
@@ -71,6 +134,16 @@ type SqlGenerator interface {
 	GenCount(table *TableMetadata, sqls sqlClauseList) (string, []interface{})
 }
 
+//SavepointGenerator is implemented by SqlGenerator which supports savepoints in transaction
+type SavepointGenerator interface {
+	//Generates sql to create savepoint
+	GenSavepoint(name string) string
+	//Generates sql to rollback to savepoint
+	GenRollbackTo(name string) string
+	//Generates sql to release savepoint, empty if not supported
+	GenReleaseSavepoint(name string) string
+}
+
 type BaseGenerator struct {
 	bufPool  *sync.Pool
 	wrapFunc func(string) string
@@ -92,23 +165,49 @@ func (b *BaseGenerator) getBuf() *bytes.Buffer {
 }
 
 func (m *BaseGenerator) GenCount(table *TableMetadata, sqls sqlClauseList) (string, []interface{}) {
+	return m.genCount(m.GenSelect, table, sqls, "with recursive ")
+}
+
+//Generates count sql, genSelect and recursiveKeyword are the ones of driver
+func (m *BaseGenerator) genCount(genSelect func(*TableMetadata, sqlClauseList) (string, []interface{}),
+	table *TableMetadata, sqls sqlClauseList, recursiveKeyword string) (string, []interface{}) {
+	withSql, withArgs := m.genWith(sqls, recursiveKeyword)
+	if sqls.has(opType_union) {
+		sqlStr, args := countOf(genSelect, table, sqls)
+		return withSql + sqlStr, append(withArgs, args...)
+	}
 	buf := m.getBuf()
 	defer m.putBuf(buf)
 	var args []interface{}
 	sort.Sort(sqls)
+	qualify := m.columnQualifier(table, sqls)
 	hasWhere := false
-	buf.WriteString(fmt.Sprintf("select count(1) from %s", m.wrapColumn(table.Name)))
+	tableName := m.wrapColumn(table.Name)
 	for _, s := range sqls {
+		if s.op == opType_table {
+			tableName = s.clause
+		}
+	}
+	buf.WriteString(fmt.Sprintf("select count(1) from %s", tableName))
+	for _, s := range sqls {
+		if s.cond != nil {
+			s.clause, s.params = genCond(s.cond, m.wrapColumn)
+		}
 		switch s.op {
 		case opType_rawQuery:
 			return s.clause, s.params
+		case opType_alias:
+			buf.WriteString(" " + s.clause)
 		case opType_unlockTable:
 			buf.WriteString(" with(nolock) ")
+		case opType_join:
+			buf.WriteString(m.genJoin(s))
+			args = append(args, s.params...)
 		case opType_id:
 			if hasWhere {
-				buf.WriteString(fmt.Sprintf(" and %s=?", table.IdColumn.name))
+				buf.WriteString(fmt.Sprintf(" and %s=?", qualify(table.IdColumn)+table.IdColumn.name))
 			} else {
-				buf.WriteString(fmt.Sprintf(" where %s=?", table.IdColumn.name))
+				buf.WriteString(fmt.Sprintf(" where %s=?", qualify(table.IdColumn)+table.IdColumn.name))
 				hasWhere = true
 			}
 			args = append(args, s.params...)
@@ -154,7 +253,15 @@ func (m *BaseGenerator) GenCount(table *TableMetadata, sqls sqlClauseList) (stri
 			break
 		}
 	}
-	return fmt.Sprintf(buf.String()), args
+	return withSql + buf.String(), append(withArgs, args...)
+}
+
+//Counts rows of select generated by genSelect, used when count(1) can not replace the selected columns, e.g. union.
+//Order and paging are removed as they do not change the count, with clause is left to the caller
+//as it must precede the outer select.
+func countOf(genSelect func(*TableMetadata, sqlClauseList) (string, []interface{}), table *TableMetadata, sqls sqlClauseList) (string, []interface{}) {
+	sqlStr, args := genSelect(table, sqls.without(opType_orderby, opType_limit, opType_top, opType_with, opType_withRecursive))
+	return "select count(1) from (" + sqlStr + ") t", args
 }
 
 //Generates select SQL statement
@@ -172,12 +279,17 @@ func (m *BaseGenerator) GenSelect(table *TableMetadata, sqls sqlClauseList) (str
 	}
 	sqls = append(sqls, sqlClause{op: opType_table, clause: m.wrapColumn(table.Name)})
 BE:
+	withSql, withArgs := m.genWith(sqls, "with recursive ")
 	sort.Sort(sqls)
+	qualify := m.columnQualifier(table, sqls)
 	isPaging := false
 	hasWhere := false
 	var pagingParam []interface{}
 	buf.WriteString("select ")
 	for _, s := range sqls {
+		if s.cond != nil {
+			s.clause, s.params = genCond(s.cond, m.wrapColumn)
+		}
 		switch s.op {
 		case opType_rawQuery:
 			return s.clause, s.params
@@ -185,6 +297,11 @@ BE:
 			// buf.WriteString(fmt.Sprintf("top %v ", s.params...))
 			isPaging = true
 			pagingParam = []interface{}{0, 1}
+		case opType_distinct:
+			buf.WriteString("distinct ")
+			if s.clause != "" {
+				colNames = s.clause
+			}
 		case opType_cols:
 			colNames = s.clause
 		case opType_omit:
@@ -192,14 +309,18 @@ BE:
 		case opType_table:
 			buf.WriteString("%s")
 			buf.WriteString(fmt.Sprintf(" from %v", s.clause))
-
+		case opType_alias:
+			buf.WriteString(" " + s.clause)
 		case opType_unlockTable:
 			buf.WriteString(" with(nolock) ")
+		case opType_join:
+			buf.WriteString(m.genJoin(s))
+			args = append(args, s.params...)
 		case opType_id:
 			if hasWhere {
-				buf.WriteString(fmt.Sprintf(" and %s=?", table.IdColumn.name))
+				buf.WriteString(fmt.Sprintf(" and %s=?", qualify(table.IdColumn)+table.IdColumn.name))
 			} else {
-				buf.WriteString(fmt.Sprintf(" where %s=?", table.IdColumn.name))
+				buf.WriteString(fmt.Sprintf(" where %s=?", qualify(table.IdColumn)+table.IdColumn.name))
 				hasWhere = true
 			}
 			args = append(args, s.params...)
@@ -241,6 +362,9 @@ BE:
 		case opType_between_or:
 			buf.WriteString(fmt.Sprintf(" or (%s between ? and ?)", s.clause))
 			args = append(args, s.params...)
+		case opType_union:
+			buf.WriteString(" " + s.clause)
+			args = append(args, s.params...)
 		case opType_limit:
 			isPaging = true
 			pagingParam = s.params
@@ -254,6 +378,14 @@ BE:
 	if isPaging {
 		buf.WriteString(fmt.Sprintf(" limit %v,%v", pagingParam[0], pagingParam[1]))
 	}
+	if mode, wait := sqls.rowLock(); mode != "" {
+		buf.WriteString(" for ")
+		buf.WriteString(mode)
+		if wait != "" {
+			buf.WriteString(" ")
+			buf.WriteString(wait)
+		}
+	}
 	if len(colNames) <= 0 {
 		cols := make([]string, 0, len(table.Columns))
 		table.Columns.Foreach(func(colKey string, col *columnMetadata) {
@@ -265,12 +397,24 @@ BE:
 						}
 					}
 				}
-				cols = append(cols, m.wrapColumn(col.name))
+				cols = append(cols, m.selectColumn(qualify(col), col))
 			}
 		})
 		colNames = strings.Join(cols, ",")
 	}
-	return fmt.Sprintf(buf.String(), colNames), args
+	return withSql + fmt.Sprintf(buf.String(), colNames), append(withArgs, args...)
+}
+
+func (m *BaseGenerator) GenSavepoint(name string) string {
+	return "savepoint " + name
+}
+
+func (m *BaseGenerator) GenRollbackTo(name string) string {
+	return "rollback to savepoint " + name
+}
+
+func (m *BaseGenerator) GenReleaseSavepoint(name string) string {
+	return "release savepoint " + name
 }
 
 func (m *BaseGenerator) makeInArgs(params []interface{}) string {
@@ -496,6 +640,9 @@ func (m *BaseGenerator) GenUpdate(value reflect.Value, table *TableMetadata, sql
 	hasWhere := false
 	hasTableName := false
 	for _, s := range sqls {
+		if s.cond != nil {
+			s.clause, s.params = genCond(s.cond, m.wrapColumn)
+		}
 		switch s.op {
 		case opType_table:
 			hasTableName = true
@@ -610,6 +757,9 @@ func (m *BaseGenerator) GenDelete(table *TableMetadata, sqls sqlClauseList) (str
 	buf.WriteString(m.wrapColumn(table.Name))
 BE:
 	for _, s := range sqls {
+		if s.cond != nil {
+			s.clause, s.params = genCond(s.cond, m.wrapColumn)
+		}
 		switch s.op {
 		case opType_table:
 			continue
@@ -28,17 +28,33 @@ func (m *MSSqlGenerator) GenSelect(table *TableMetadata, sqls sqlClauseList) (st
 	var args []interface{}
 	var colNames string
 	var omitCols []string
-	sqls = append(sqls, sqlClause{op: opType_table, clause: m.wrapColumn(table.Name)})
+	if !sqls.has(opType_table) {
+		sqls = append(sqls, sqlClause{op: opType_table, clause: m.wrapColumn(table.Name)})
+	}
+	withSql, withArgs := m.genWith(sqls, "with ")
 	sort.Sort(sqls)
+	qualify := m.columnQualifier(table, sqls)
 	isPaging := false
-	pagingOrder := table.IdColumn.name
+	hasLock := false
+	pagingOrder := "(select null)"
+	if table.IdColumn != nil {
+		pagingOrder = qualify(table.IdColumn) + table.IdColumn.name
+	}
 	hasWhere := false
 	var pagingParam []interface{}
 	buf.WriteString("select ")
 	for _, s := range sqls {
+		if s.cond != nil {
+			s.clause, s.params = genCond(s.cond, m.wrapColumn)
+		}
 		switch s.op {
 		case opType_rawQuery:
 			return s.clause, s.params
+		case opType_distinct:
+			buf.WriteString("distinct ")
+			if s.clause != "" {
+				colNames = s.clause
+			}
 		case opType_top:
 			buf.WriteString(fmt.Sprintf("top %v ", s.params...))
 		case opType_cols:
@@ -48,13 +64,36 @@ func (m *MSSqlGenerator) GenSelect(table *TableMetadata, sqls sqlClauseList) (st
 		case opType_table:
 			buf.WriteString("%s")
 			buf.WriteString(fmt.Sprintf(" from %v", s.clause))
+		case opType_alias:
+			buf.WriteString(" " + s.clause)
 		case opType_unlockTable:
 			buf.WriteString(" with(nolock) ")
+		case opType_lock:
+			if hasLock {
+				break
+			}
+			hasLock = true
+			mode, wait := sqls.rowLock()
+			if mode == lock_share {
+				buf.WriteString(" with(holdlock,rowlock")
+			} else {
+				buf.WriteString(" with(updlock,rowlock")
+			}
+			switch wait {
+			case lock_skipLocked:
+				buf.WriteString(",readpast")
+			case lock_nowait:
+				buf.WriteString(",nowait")
+			}
+			buf.WriteString(")")
+		case opType_join:
+			buf.WriteString(m.genJoin(s))
+			args = append(args, s.params...)
 		case opType_id:
 			if hasWhere {
-				buf.WriteString(fmt.Sprintf(" and %s=?", table.IdColumn.name))
+				buf.WriteString(fmt.Sprintf(" and %s=?", qualify(table.IdColumn)+table.IdColumn.name))
 			} else {
-				buf.WriteString(fmt.Sprintf(" where %s=?", table.IdColumn.name))
+				buf.WriteString(fmt.Sprintf(" where %s=?", qualify(table.IdColumn)+table.IdColumn.name))
 				hasWhere = true
 			}
 			args = append(args, s.params...)
@@ -97,6 +136,9 @@ func (m *MSSqlGenerator) GenSelect(table *TableMetadata, sqls sqlClauseList) (st
 		case opType_between_or:
 			buf.WriteString(fmt.Sprintf(" or (%s between ? and ?)", s.clause))
 			args = append(args, s.params...)
+		case opType_union:
+			buf.WriteString(" " + s.clause)
+			args = append(args, s.params...)
 		case opType_limit:
 			buf.WriteString("ROW_NUMBER() OVER (order by %s) as row,")
 			isPaging = true
@@ -124,7 +166,7 @@ func (m *MSSqlGenerator) GenSelect(table *TableMetadata, sqls sqlClauseList) (st
 						}
 					}
 				}
-				cols = append(cols, m.wrapColumn(col.name))
+				cols = append(cols, m.selectColumn(qualify(col), col))
 			}
 		})
 		colNames = strings.Join(cols, ",")
@@ -132,9 +174,27 @@ func (m *MSSqlGenerator) GenSelect(table *TableMetadata, sqls sqlClauseList) (st
 	if isPaging {
 		sqlStr := fmt.Sprintf("select top %[3]v * from (%[1]s) t where t.row > %[2]v",
 			fmt.Sprintf(buf.String(), pagingOrder, colNames), pagingParam[0], pagingParam[1])
-		return sqlStr, args
+		return withSql + sqlStr, append(withArgs, args...)
 	}
-	return fmt.Sprintf(buf.String(), colNames), args
+	return withSql + fmt.Sprintf(buf.String(), colNames), append(withArgs, args...)
+}
+
+//Generates count sql, union is counted by the select of SQL Server
+func (m *MSSqlGenerator) GenCount(table *TableMetadata, sqls sqlClauseList) (string, []interface{}) {
+	return m.genCount(m.GenSelect, table, sqls, "with ")
+}
+
+func (m *MSSqlGenerator) GenSavepoint(name string) string {
+	return "save transaction " + name
+}
+
+func (m *MSSqlGenerator) GenRollbackTo(name string) string {
+	return "rollback transaction " + name
+}
+
+//SQL Server releases savepoints when transaction ends
+func (m *MSSqlGenerator) GenReleaseSavepoint(name string) string {
+	return ""
 }
 
 func (m *MSSqlGenerator) GenMultiInsert(value reflect.Value, table *TableMetadata, sqls sqlClauseList) (string, []interface{}) {
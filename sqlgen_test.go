@@ -0,0 +1,422 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type genUser struct {
+	TabName  TableName `shorm:"T_User"`
+	Id       int64     `shorm:"UserId,pk,shard"`
+	UserName string
+	Age      int32
+}
+
+type genCase struct {
+	name string
+	gen  SqlGenerator
+	sqls sqlClauseList
+	sql  string
+	args []interface{}
+}
+
+func runGenSelectCases(t *testing.T, cases []genCase) {
+	table, err := getTableMeta(genUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		sql, args := c.gen.GenSelect(table, c.sqls)
+		if sql != c.sql {
+			t.Errorf("%s:\n\texpected %s\n\tbut      %s", c.name, c.sql, sql)
+		}
+		if len(args) != len(c.args) || (len(args) > 0 && !reflect.DeepEqual(args, c.args)) {
+			t.Errorf("%s: expected args %v, but %v", c.name, c.args, args)
+		}
+	}
+}
+
+func TestGenSelectRowLock(t *testing.T) {
+	base, mssql := newBaseGenerator(), NewMSSqlGenerator()
+	where := sqlClause{op: opType_where, clause: "Age>?", params: []interface{}{18}}
+	runGenSelectCases(t, []genCase{
+		{
+			name: "for update",
+			gen:  base,
+			sqls: sqlClauseList{where, {op: opType_lock, clause: lock_update}},
+			sql:  "select `Age`,`UserId`,`UserName` from `T_User` where Age>? for update",
+			args: []interface{}{18},
+		},
+		{
+			name: "for share nowait",
+			gen:  base,
+			sqls: sqlClauseList{where, {op: opType_lock, clause: lock_share}, {op: opType_lock, clause: lock_nowait}},
+			sql:  "select `Age`,`UserId`,`UserName` from `T_User` where Age>? for share nowait",
+			args: []interface{}{18},
+		},
+		{
+			name: "skip locked implies for update",
+			gen:  base,
+			sqls: sqlClauseList{where, {op: opType_lock, clause: lock_skipLocked}},
+			sql:  "select `Age`,`UserId`,`UserName` from `T_User` where Age>? for update skip locked",
+			args: []interface{}{18},
+		},
+		{
+			name: "mssql updlock readpast",
+			gen:  mssql,
+			sqls: sqlClauseList{where, {op: opType_lock, clause: lock_update}, {op: opType_lock, clause: lock_skipLocked}},
+			sql:  "select [Age],[UserId],[UserName] from [T_User] with(updlock,rowlock,readpast) where Age>?",
+			args: []interface{}{18},
+		},
+	})
+}
+
+func TestGenSelectCond(t *testing.T) {
+	base, mssql := newBaseGenerator(), NewMSSqlGenerator()
+	cond := And(
+		Gt("Age", 18),
+		Or(Like("u.UserName", "sz%"), IsNull("UserName")),
+		Not(In("UserId", []int64{1, 2})),
+		Expr("Age<?", 60),
+	)
+	runGenSelectCases(t, []genCase{
+		{
+			name: "base where cond",
+			gen:  base,
+			sqls: sqlClauseList{{op: opType_where, cond: cond}},
+			sql:  "select `Age`,`UserId`,`UserName` from `T_User` where (`Age`>? and (`u`.`UserName` like ? or `UserName` is null) and not (`UserId` in (?,?)) and (Age<?))",
+			args: []interface{}{18, "sz%", int64(1), int64(2), 60},
+		},
+		{
+			name: "mssql raw where with or cond",
+			gen:  mssql,
+			sqls: sqlClauseList{{op: opType_where, clause: "Age>?", params: []interface{}{18}}, {op: opType_or, cond: And(Eq("UserName", "sz"), NotIn("UserId"))}},
+			sql:  "select [Age],[UserId],[UserName] from [T_User] where Age>? or (([UserName]=? and 1=1))",
+			args: []interface{}{18, "sz"},
+		},
+	})
+}
+
+func TestWhereStructAndMap(t *testing.T) {
+	table, err := getTableMeta(genUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runWhereCases(t, table, newBaseGenerator(), []whereCase{
+		{
+			name:  "non-zero fields",
+			where: W().WhereStruct(&genUser{UserName: "sz", Age: 18}),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where (`Age`=? and `UserName`=?)",
+			args:  []interface{}{int32(18), "sz"},
+		},
+		{
+			name:  "listed fields",
+			where: W().WhereStruct(&genUser{UserName: "sz"}, "age"),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where `Age`=?",
+			args:  []interface{}{int32(0)},
+		},
+		{name: "zero struct", where: W().WhereStruct(&genUser{}).Limit(0, 10), err: ErrNoCondition},
+		{
+			name:  "map",
+			where: W().WhereMap(map[string]interface{}{"userid": []int64{1, 2}, "USERNAME": nil, "Age": 18}),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where (`Age`=? and `UserName` is null and `UserId` in (?,?))",
+			args:  []interface{}{18, int64(1), int64(2)},
+		},
+		{name: "unknown listed field", where: W().WhereStruct(&genUser{}, "Email"), err: ErrUnknownColumn},
+		{name: "unknown key", where: W().WhereMap(map[string]interface{}{"Age; drop table T_User": 1}), err: ErrUnknownColumn},
+		{name: "field not in table", where: W().WhereStruct(&genOrder{Status: 2}), err: ErrUnknownColumn},
+		{
+			name:  "empty map",
+			where: W().WhereMap(map[string]interface{}{}).Limit(0, 10),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` limit 0,10",
+		},
+		{
+			name:  "not empty map",
+			where: W().Where("Age=?", 1).WhereCond(Not(mapCond{})),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where Age=? and not (1=1)",
+			args:  []interface{}{1},
+		},
+		{
+			name:  "empty map in groups",
+			where: W().WhereCond(And(Eq("Age", 1), mapCond{}, Or(Eq("UserName", "sz"), mapCond{}))),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where (`Age`=? and 1=1 and (`UserName`=? or 1=1))",
+			args:  []interface{}{1, "sz"},
+		},
+	})
+
+	s := &Session{sqlGen: plainGenerator{newBaseGenerator()}, clauseList: sqlClauseList(W().WhereStruct(&genUser{Id: 1}))}
+	if err := s.resolveConds(table); err == nil {
+		t.Errorf("WhereStruct is resolved by generator without valueGetter")
+	}
+}
+
+func TestUnresolvedCond(t *testing.T) {
+	for _, cond := range []Cond{
+		mapCond{"Age`=1 or 1=1 -- ": 1},
+		structCond{model: &genUser{UserName: "sz"}},
+		inSubCond{col: "UserId", sub: Sub(&genOrder{}, W().Cols("UserId"))},
+		existsCond{sub: Sub(&genOrder{}, nil)},
+		rawSubCond{clause: "UserId in ?"},
+		unionCond{sub: Sub(&genUser{}, nil)},
+		withCond{name: "adult", sub: Sub(&genUser{}, nil)},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%T is built without resolving", cond)
+				}
+			}()
+			genCond(cond, newBaseGenerator().wrapColumn)
+		}()
+	}
+}
+
+type whereCase struct {
+	name  string
+	where SqlWhere
+	sql   string
+	args  []interface{}
+	err   error
+}
+
+//Resolves conditions of where and generates select sql
+func runWhereCases(t *testing.T, table *TableMetadata, gen SqlGenerator, cases []whereCase) {
+	for _, c := range cases {
+		s := &Session{sqlGen: gen, clauseList: sqlClauseList(c.where)}
+		err := s.resolveConds(table)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: expected error %v, but %v", c.name, c.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		sql, args := s.sqlGen.GenSelect(table, s.clauseList)
+		if sql != c.sql {
+			t.Errorf("%s:\n\texpected %s\n\tbut      %s", c.name, c.sql, sql)
+		}
+		if len(args) != len(c.args) || (len(args) > 0 && !reflect.DeepEqual(args, c.args)) {
+			t.Errorf("%s: expected args %v, but %v", c.name, c.args, args)
+		}
+	}
+}
+
+type genOrder struct {
+	TabName TableName `shorm:"T_Order"`
+	Id      int64     `shorm:"OrderId,pk"`
+	UserId  int64     `shorm:",shard"`
+	Status  int
+}
+
+func TestSubQuery(t *testing.T) {
+	table, err := getTableMeta(genUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid := Sub(&genOrder{}, W().Cols("UserId").Where("Status=?", 2))
+	runWhereCases(t, table, newBaseGenerator(), []whereCase{
+		{
+			name:  "in",
+			where: W().Where("Age>?", 18).In("UserId", paid),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where Age>? and `UserId` in (select UserId from `T_Order` where Status=?)",
+			args:  []interface{}{18, 2},
+		},
+		{
+			name:  "not in cond",
+			where: W().WhereCond(And(Gt("Age", 18), NotIn("UserId", paid))),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where (`Age`>? and `UserId` not in (select UserId from `T_Order` where Status=?))",
+			args:  []interface{}{18, 2},
+		},
+		{
+			name:  "raw where",
+			where: W().Where("Age>? and UserId in ? and UserName<>'?'", 18, paid),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where Age>? and UserId in (select UserId from `T_Order` where Status=?) and UserName<>'?'",
+			args:  []interface{}{18, 2},
+		},
+		{
+			name:  "exists",
+			where: W().WhereNotExists(Sub(&genOrder{}, W().Where("T_Order.UserId=T_User.UserId"))).And("Age>?", 18),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where not exists (select `OrderId`,`Status`,`UserId` from `T_Order` where T_Order.UserId=T_User.UserId) and Age>?",
+			args:  []interface{}{18},
+		},
+		{
+			name:  "union all",
+			where: W().Where("Age<?", 18).UnionAll(Sub(&genUser{}, W().Where("Age>?", 60))).OrderBy("Age"),
+			sql:   "select `Age`,`UserId`,`UserName` from `T_User` where Age<? union all select `Age`,`UserId`,`UserName` from `T_User` where Age>? order by Age",
+			args:  []interface{}{18, 60},
+		},
+	})
+}
+
+func TestGenCountUnion(t *testing.T) {
+	table, err := getTableMeta(genUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		gen SqlGenerator
+		sql string
+	}{
+		{newBaseGenerator(), "select count(1) from (select `Age`,`UserId`,`UserName` from `T_User` where Age<? union all " +
+			"select `Age`,`UserId`,`UserName` from `T_User` where Age>?) t"},
+		{NewMSSqlGenerator(), "select count(1) from (select [Age],[UserId],[UserName] from [T_User] where Age<? union all " +
+			"select [Age],[UserId],[UserName] from [T_User] where Age>?) t"},
+	} {
+		where := W().Where("Age<?", 18).UnionAll(Sub(&genUser{}, W().Where("Age>?", 60))).OrderBy("Age").Limit(0, 10)
+		s := &Session{sqlGen: c.gen, clauseList: sqlClauseList(where)}
+		if err := s.resolveConds(table); err != nil {
+			t.Fatal(err)
+		}
+		sql, args := c.gen.GenCount(table, s.clauseList)
+		if sql != c.sql {
+			t.Errorf("%T:\n\texpected %s\n\tbut      %s", c.gen, c.sql, sql)
+		}
+		if !reflect.DeepEqual(args, []interface{}{18, 60}) {
+			t.Errorf("%T: expected args [18 60], but %v", c.gen, args)
+		}
+	}
+}
+
+func TestGenCountWith(t *testing.T) {
+	table, err := getTableMeta(genUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := func() SqlWhere {
+		return W().WithRecursive("tree", Sub(&genUser{}, W().Where("UserId=?", 1).
+			UnionAll(Sub(&genUser{}, W().Alias("u").Join("tree", "t", "u.Age=t.Age+1"))))).Table("tree")
+	}
+	for _, c := range []struct {
+		name  string
+		gen   SqlGenerator
+		where SqlWhere
+		sql   string
+		args  []interface{}
+	}{
+		{
+			name:  "recursive",
+			gen:   newBaseGenerator(),
+			where: tree().Where("Age<?", 60),
+			sql: "with recursive tree as (select `Age`,`UserId`,`UserName` from `T_User` where UserId=? union all " +
+				"select u.`Age`,u.`UserId`,u.`UserName` from `T_User` u join `tree` t on u.Age=t.Age+1) " +
+				"select count(1) from tree where Age<?",
+			args: []interface{}{1, 60},
+		},
+		{
+			name:  "mssql recursive",
+			gen:   NewMSSqlGenerator(),
+			where: tree().Where("Age<?", 60),
+			sql: "with tree as (select [Age],[UserId],[UserName] from [T_User] where UserId=? union all " +
+				"select u.[Age],u.[UserId],u.[UserName] from [T_User] u join [tree] t on u.Age=t.Age+1) " +
+				"select count(1) from tree where Age<?",
+			args: []interface{}{1, 60},
+		},
+		{
+			name:  "union of expression",
+			gen:   newBaseGenerator(),
+			where: W().With("adult", Sub(&genUser{}, W().Where("Age>=?", 18))).Table("adult").UnionAll(Sub(&genUser{}, W().Where("Age<?", 6))),
+			sql: "with adult as (select `Age`,`UserId`,`UserName` from `T_User` where Age>=?) " +
+				"select count(1) from (select `Age`,`UserId`,`UserName` from adult union all select `Age`,`UserId`,`UserName` from `T_User` where Age<?) t",
+			args: []interface{}{18, 6},
+		},
+	} {
+		s := &Session{sqlGen: c.gen, clauseList: sqlClauseList(c.where)}
+		if err := s.resolveConds(table); err != nil {
+			t.Fatal(err)
+		}
+		sql, args := c.gen.GenCount(table, s.clauseList)
+		if sql != c.sql {
+			t.Errorf("%s:\n\texpected %s\n\tbut      %s", c.name, c.sql, sql)
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%s: expected args %v, but %v", c.name, c.args, args)
+		}
+	}
+}
+
+func TestWith(t *testing.T) {
+	table, err := getTableMeta(genUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := Sub(&genUser{}, W().Where("UserId=?", 1).
+		UnionAll(Sub(&genUser{}, W().Alias("u").Join("tree", "t", "u.Age=t.Age+1"))))
+	runWhereCases(t, table, newBaseGenerator(), []whereCase{
+		{
+			name:  "recursive",
+			where: W().WithRecursive("tree", tree).Table("tree").Where("Age<?", 60),
+			sql: "with recursive tree as (select `Age`,`UserId`,`UserName` from `T_User` where UserId=? union all " +
+				"select u.`Age`,u.`UserId`,u.`UserName` from `T_User` u join `tree` t on u.Age=t.Age+1) " +
+				"select `Age`,`UserId`,`UserName` from tree where Age<?",
+			args: []interface{}{1, 60},
+		},
+		{
+			name: "in order of declaration",
+			where: W().With("adult", Sub(&genUser{}, W().Where("Age>=?", 18))).
+				With("named", Sub(&genUser{}, W().Table("adult").Where("UserName=?", "sz"))).Table("named"),
+			sql: "with adult as (select `Age`,`UserId`,`UserName` from `T_User` where Age>=?)," +
+				"named as (select `Age`,`UserId`,`UserName` from adult where UserName=?) " +
+				"select `Age`,`UserId`,`UserName` from named",
+			args: []interface{}{18, "sz"},
+		},
+	})
+	runWhereCases(t, table, NewMSSqlGenerator(), []whereCase{
+		{
+			name:  "mssql recursive with paging",
+			where: W().WithRecursive("tree", tree).Table("tree").Limit(10, 5),
+			sql: "with tree as (select [Age],[UserId],[UserName] from [T_User] where UserId=? union all " +
+				"select u.[Age],u.[UserId],u.[UserName] from [T_User] u join [tree] t on u.Age=t.Age+1) " +
+				"select top 5 * from (select ROW_NUMBER() OVER (order by UserId) as row,[Age],[UserId],[UserName] from tree) t where t.row > 10",
+			args: []interface{}{1},
+		},
+	})
+}
+
+func TestGenSelectDistinct(t *testing.T) {
+	base, mssql := newBaseGenerator(), NewMSSqlGenerator()
+	where := sqlClause{op: opType_where, clause: "Age>?", params: []interface{}{18}}
+	runGenSelectCases(t, []genCase{
+		{
+			name: "distinct all columns",
+			gen:  base,
+			sqls: sqlClauseList{where, {op: opType_distinct}},
+			sql:  "select distinct `Age`,`UserId`,`UserName` from `T_User` where Age>?",
+			args: []interface{}{18},
+		},
+		{
+			name: "distinct cols with limit",
+			gen:  base,
+			sqls: sqlClauseList{where, {op: opType_limit, params: []interface{}{0, 10}}, {op: opType_distinct, clause: "Age"}},
+			sql:  "select distinct Age from `T_User` where Age>? limit 0,10",
+			args: []interface{}{18},
+		},
+		{
+			name: "mssql distinct top",
+			gen:  mssql,
+			sqls: sqlClauseList{where, {op: opType_top, params: []interface{}{1}}, {op: opType_distinct, clause: "Age"}},
+			sql:  "select distinct top 1 Age from [T_User] where Age>?",
+			args: []interface{}{18},
+		},
+	})
+}
+
+func TestDistinctValuePairs(t *testing.T) {
+	now := time.Now()
+	row := func(name string, created *time.Time) valuePairs {
+		return valuePairs{{value: sql.NullString{String: name, Valid: true}}, {value: created}}
+	}
+	list := valuePairList{row("a", &now), row("b", &now), row("a", &now), row("a", nil), row("a", nil)}.distinct()
+	if len(list) != 3 {
+		t.Errorf("expected 3 rows, but %d", len(list))
+	}
+	if distinctKey(int64(1)) == distinctKey("1") {
+		t.Error("values of different types should not be equal")
+	}
+}
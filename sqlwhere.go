@@ -15,8 +15,11 @@ type SqlWhere sqlClauseList
 // W 新建 sql where 实例
 func W() SqlWhere { return SqlWhere{} }
 
-// Where equals < where col=? >
+// Where equals < where col=? >, arg of subquery created by Sub replaces its ? with (select ...)
 func (s SqlWhere) Where(clause string, args ...interface{}) SqlWhere {
+	if hasSubQuery(args) {
+		return append(s, sqlClause{op: opType_where, cond: rawSubCond{clause, args}})
+	}
 	subSql := sqlClause{
 		op:     opType_where,
 		clause: clause,
@@ -30,6 +33,9 @@ func (s SqlWhere) Where(clause string, args ...interface{}) SqlWhere {
 
 // And equals < and col=? >
 func (s SqlWhere) And(clause string, args ...interface{}) SqlWhere {
+	if hasSubQuery(args) {
+		return append(s, sqlClause{op: opType_and, cond: rawSubCond{clause, args}})
+	}
 	subSql := sqlClause{
 		op:     opType_and,
 		clause: clause,
@@ -43,6 +49,9 @@ func (s SqlWhere) And(clause string, args ...interface{}) SqlWhere {
 
 // Or equals < or col=? >
 func (s SqlWhere) Or(clause string, args ...interface{}) SqlWhere {
+	if hasSubQuery(args) {
+		return append(s, sqlClause{op: opType_or, cond: rawSubCond{clause, args}})
+	}
 	subSql := sqlClause{
 		op:     opType_or,
 		clause: clause,
@@ -54,8 +63,13 @@ func (s SqlWhere) Or(clause string, args ...interface{}) SqlWhere {
 	return s
 }
 
-// In equals < and col in(?) >
+// In equals < and col in(?) >, single arg can be a subquery created by Sub
 func (s SqlWhere) In(colName string, args ...interface{}) SqlWhere {
+	if len(args) == 1 {
+		if sub, ok := args[0].(*SubQuery); ok {
+			return s.WhereCond(In(colName, sub))
+		}
+	}
 	subSql := sqlClause{
 		op:     opType_in,
 		clause: colName,
@@ -149,6 +163,11 @@ func (s SqlWhere) Cols(cols string) SqlWhere {
 	return s
 }
 
+// Distinct equals < select distinct cols >, all selected columns if cols is empty
+func (s SqlWhere) Distinct(cols string) SqlWhere {
+	return append(s, sqlClause{op: opType_distinct, clause: cols})
+}
+
 // Omit specify which columns will not be selected or affected
 func (s SqlWhere) Omit(cols string) SqlWhere {
 	subSql := sqlClause{
@@ -0,0 +1,247 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Subqueries, exists and union of selects
+
+package shorm
+
+import (
+	"bytes"
+)
+
+// SubQuery is select statement of model built from SqlWhere, used by In, Exists, Where and Union.
+// It is executed on the same db node of the outer query, so tables should be co-located.
+type SubQuery struct {
+	model interface{}
+	where SqlWhere
+}
+
+// Sub creates subquery selecting from table of model with the clauses of where,
+// selected column should be specified by Cols if the subquery is used by In.
+/*
+	Usage:
+		// where `UserId` in (select `UserId` from `T_User` where Age>?)
+		session.In("UserId", shorm.Sub(&User{}, shorm.W().Cols("UserId").Where("Age>?", 18))).Find(&orders)
+*/
+func Sub(model interface{}, where SqlWhere) *SubQuery {
+	return &SubQuery{model: model, where: where}
+}
+
+//Generates select sql of subquery by generator of the outer query
+func (q *SubQuery) render(gen SqlGenerator) (string, []interface{}, error) {
+	table, err := getTableMeta(q.model)
+	if err != nil {
+		return "", nil, err
+	}
+	s := &Session{sqlGen: gen, clauseList: append(sqlClauseList(nil), q.where...)}
+	if err = s.resolveConds(table); err != nil {
+		return "", nil, err
+	}
+	sqlStr, args := gen.GenSelect(table, s.clauseList)
+	return sqlStr, args, nil
+}
+
+func hasSubQuery(args []interface{}) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*SubQuery); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//Rendered subquery, e.g. < col in (select ...) > or < exists (select ...) >
+type subCond struct {
+	col  string
+	op   string
+	sql  string
+	args []interface{}
+}
+
+func (c subCond) build(b *condBuilder) {
+	if c.col != "" {
+		b.writeColumn(c.col)
+	}
+	b.buf.WriteString(c.op)
+	b.buf.WriteString("(")
+	b.buf.WriteString(c.sql)
+	b.buf.WriteString(")")
+	b.args = append(b.args, c.args...)
+}
+
+type inSubCond struct {
+	col string
+	sub *SubQuery
+	not bool
+}
+
+func (c inSubCond) build(b *condBuilder) {
+	unresolved(c)
+}
+
+func (c inSubCond) resolve(table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	sqlStr, args, err := c.sub.render(gen)
+	if err != nil {
+		return nil, err
+	}
+	op := " in "
+	if c.not {
+		op = " not in "
+	}
+	return subCond{col: c.col, op: op, sql: sqlStr, args: args}, nil
+}
+
+type existsCond struct {
+	sub *SubQuery
+	not bool
+}
+
+func (c existsCond) build(b *condBuilder) {
+	unresolved(c)
+}
+
+func (c existsCond) resolve(table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	sqlStr, args, err := c.sub.render(gen)
+	if err != nil {
+		return nil, err
+	}
+	op := "exists "
+	if c.not {
+		op = "not exists "
+	}
+	return subCond{op: op, sql: sqlStr, args: args}, nil
+}
+
+// Exists equals < exists (select ...) >
+func Exists(sub *SubQuery) Cond { return existsCond{sub: sub} }
+
+// NotExists equals < not exists (select ...) >
+func NotExists(sub *SubQuery) Cond { return existsCond{sub: sub, not: true} }
+
+//Raw sql fragment rendered as is
+type rawCond struct {
+	clause string
+	args   []interface{}
+}
+
+func (c rawCond) build(b *condBuilder) {
+	b.buf.WriteString(c.clause)
+	b.args = append(b.args, c.args...)
+}
+
+//Raw where clause whose args contain subqueries
+type rawSubCond struct {
+	clause string
+	args   []interface{}
+}
+
+func (c rawSubCond) build(b *condBuilder) {
+	unresolved(c)
+}
+
+//Replaces each ? of subquery argument with (select ...), args are merged in order of placeholders
+func (c rawSubCond) resolve(table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	var buf bytes.Buffer
+	var args []interface{}
+	n := 0
+	for i := 0; i < len(c.clause); i++ {
+		switch {
+		case isLiteralStart(c.clause, i):
+			end := skipLiteral(c.clause, i)
+			buf.WriteString(c.clause[i:end])
+			i = end - 1
+		case c.clause[i] == '?' && n < len(c.args):
+			if sub, ok := c.args[n].(*SubQuery); ok {
+				sqlStr, subArgs, err := sub.render(gen)
+				if err != nil {
+					return nil, err
+				}
+				buf.WriteString("(" + sqlStr + ")")
+				args = append(args, subArgs...)
+			} else {
+				buf.WriteString("?")
+				args = append(args, c.args[n])
+			}
+			n++
+		default:
+			buf.WriteByte(c.clause[i])
+		}
+	}
+	return rawCond{buf.String(), append(args, c.args[n:]...)}, nil
+}
+
+type unionCond struct {
+	sub *SubQuery
+	all bool
+}
+
+func (c unionCond) build(b *condBuilder) {
+	unresolved(c)
+}
+
+func (c unionCond) resolve(table *TableMetadata, gen SqlGenerator) (Cond, error) {
+	sqlStr, args, err := c.sub.render(gen)
+	if err != nil {
+		return nil, err
+	}
+	if c.all {
+		return rawCond{"union all " + sqlStr, args}, nil
+	}
+	return rawCond{"union " + sqlStr, args}, nil
+}
+
+// WhereExists equals < where exists (select ...) >
+func (s SqlWhere) WhereExists(sub *SubQuery) SqlWhere {
+	return append(s, sqlClause{op: opType_where, cond: Exists(sub)})
+}
+
+// WhereNotExists equals < where not exists (select ...) >
+func (s SqlWhere) WhereNotExists(sub *SubQuery) SqlWhere {
+	return append(s, sqlClause{op: opType_where, cond: NotExists(sub)})
+}
+
+// Union equals < union select ... >
+func (s SqlWhere) Union(sub *SubQuery) SqlWhere {
+	return append(s, sqlClause{op: opType_union, cond: unionCond{sub: sub}})
+}
+
+// UnionAll equals < union all select ... >
+func (s SqlWhere) UnionAll(sub *SubQuery) SqlWhere {
+	return append(s, sqlClause{op: opType_union, cond: unionCond{sub: sub, all: true}})
+}
+
+// WhereExists equals < where exists (select ...) >
+/*
+	Usage:
+		// where exists (select ... from `T_Order` where T_Order.UserId=T_User.UserId)
+		session.WhereExists(shorm.Sub(&Order{}, shorm.W().Where("T_Order.UserId=T_User.UserId"))).Find(&users)
+*/
+func (s *Session) WhereExists(sub *SubQuery) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_where, cond: Exists(sub)})
+	return s
+}
+
+// WhereNotExists equals < where not exists (select ...) >
+func (s *Session) WhereNotExists(sub *SubQuery) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_where, cond: NotExists(sub)})
+	return s
+}
+
+// Union equals < union select ... >, the subquery should select the same columns,
+// order by and limit apply to the whole result.
+/*
+	Usage:
+		// select ... from `T_Order` where Status=? union all select ... from `T_OrderArchive` where Status=?
+		session.Where("Status=?", 1).UnionAll(shorm.Sub(&OrderArchive{}, shorm.W().Where("Status=?", 1))).Find(&orders)
+*/
+func (s *Session) Union(sub *SubQuery) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_union, cond: unionCond{sub: sub}})
+	return s
+}
+
+// UnionAll equals < union all select ... >, see Union
+func (s *Session) UnionAll(sub *SubQuery) *Session {
+	s.clauseList = append(s.clauseList, sqlClause{op: opType_union, cond: unionCond{sub: sub, all: true}})
+	return s
+}
@@ -6,35 +6,96 @@
 
 package shorm
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"time"
+)
 
 type DbTrans struct {
-	engine  *Engine
-	tx      *sql.Tx
-	session *Session
+	engine     *Engine
+	tx         *sql.Tx
+	session    *Session
+	group      *DbGroup
+	token      *ConsistencyToken
+	savepoints int             //count of savepoints created by nested WithTrans
+	done       bool            //committed or rolled back, session has been ended
+	ctx        context.Context //carries the transaction for nested Engine.WithTransContext
+	onCommit   []func()
+	onRollback []func()
+	hookErrs   []error
 }
 
-func newDbTrans(e *Engine, shardValue int64) (*DbTrans, error) {
+type transKey struct{}
+
+//Locates group of transaction by sharding value, default group is used if not found
+func locateTransGroup(cluster *Cluster, shardValue int64) (*DbGroup, error) {
+	if group, has := cluster.findGroup(shardValue); has {
+		return group, nil
+	}
+	return cluster.DefaultGroup()
+}
+
+func newDbTrans(e *Engine, shardValue int64, opts *sql.TxOptions) (*DbTrans, error) {
 	trans := &DbTrans{engine: e, session: e.StartSession()}
-	group, has := e.cluster.findGroup(shardValue)
-	if !has {
-		group, _ = e.cluster.DefaultGroup()
+	group, err := locateTransGroup(trans.session.cluster, shardValue)
+	if err != nil {
+		e.EndSession(trans.session)
+		return nil, err
 	}
-	node, _ := group.GetMaster()
-	var err error
-	trans.tx, err = node.Db.Begin()
+	trans.group = group
+	node, err := group.GetMaster()
+	if err != nil {
+		e.EndSession(trans.session)
+		return nil, err
+	}
+	trans.tx, err = node.Db.BeginTx(context.Background(), opts)
 	if err != nil {
 		if trans.tx != nil {
 			trans.tx.Rollback()
 		}
+		e.EndSession(trans.session)
 		return nil, err
 	}
 	return trans, nil
 }
 
 func (d *DbTrans) Commit() error {
+	if d.done {
+		return sql.ErrTxDone
+	}
+	d.done = true
 	d.engine.EndSession(d.session)
-	return d.tx.Commit()
+	if err := d.tx.Commit(); err != nil {
+		d.runHooks(d.onRollback)
+		return err
+	}
+	d.ConsistencyToken().markWrite(d.group)
+	d.runHooks(d.onCommit)
+	return nil
+}
+
+// Context returns context carrying the transaction,
+// nested Engine.WithTransContext called with it joins the transaction, see Engine.WithTransContext.
+func (d *DbTrans) Context() context.Context {
+	if d.ctx == nil {
+		d.ctx = context.WithValue(context.Background(), transKey{}, d)
+	}
+	return d.ctx
+}
+
+// ConsistencyToken returns the token records the write of committed transaction,
+// see Session.Consistent
+func (d *DbTrans) ConsistencyToken() *ConsistencyToken {
+	if d.token == nil {
+		d.token = NewConsistencyToken()
+	}
+	return d.token
 }
 
 func (d *DbTrans) Table(name string) *DbTrans {
@@ -42,8 +103,16 @@ func (d *DbTrans) Table(name string) *DbTrans {
 	return d
 
 }
+
+// Rollback aborts the transaction, it returns sql.ErrTxDone without calling hooks
+// if transaction has been committed or rolled back, so it is safe to defer Rollback after Begin.
 func (d *DbTrans) Rollback() error {
+	if d.done {
+		return sql.ErrTxDone
+	}
+	d.done = true
 	d.engine.EndSession(d.session)
+	defer d.runHooks(d.onRollback)
 	return d.tx.Rollback()
 }
 
@@ -52,6 +121,11 @@ func (d *DbTrans) Cols(cols string) *DbTrans {
 	return d
 }
 
+func (d *DbTrans) Distinct(cols string) *DbTrans {
+	d.session.Distinct(cols)
+	return d
+}
+
 func (d *DbTrans) Omit(cols string) *DbTrans {
 	d.session.Omit(cols)
 	return d
@@ -77,11 +151,172 @@ func (d *DbTrans) In(colName string, args ...interface{}) *DbTrans {
 	return d
 }
 
+func (d *DbTrans) Or(clause string, args ...interface{}) *DbTrans {
+	d.session.Or(clause, args...)
+	return d
+}
+
+func (d *DbTrans) WhereStruct(model interface{}, cols ...string) *DbTrans {
+	d.session.WhereStruct(model, cols...)
+	return d
+}
+
+func (d *DbTrans) WhereMap(values map[string]interface{}) *DbTrans {
+	d.session.WhereMap(values)
+	return d
+}
+
+func (d *DbTrans) Alias(alias string) *DbTrans {
+	d.session.Alias(alias)
+	return d
+}
+
+func (d *DbTrans) Join(table, alias, on string, args ...interface{}) *DbTrans {
+	d.session.Join(table, alias, on, args...)
+	return d
+}
+
+func (d *DbTrans) LeftJoin(table, alias, on string, args ...interface{}) *DbTrans {
+	d.session.LeftJoin(table, alias, on, args...)
+	return d
+}
+
+func (d *DbTrans) WhereCond(cond Cond) *DbTrans {
+	d.session.WhereCond(cond)
+	return d
+}
+
+func (d *DbTrans) AndCond(cond Cond) *DbTrans {
+	d.session.AndCond(cond)
+	return d
+}
+
+func (d *DbTrans) OrCond(cond Cond) *DbTrans {
+	d.session.OrCond(cond)
+	return d
+}
+
+func (d *DbTrans) WhereExists(sub *SubQuery) *DbTrans {
+	d.session.WhereExists(sub)
+	return d
+}
+
+func (d *DbTrans) WhereNotExists(sub *SubQuery) *DbTrans {
+	d.session.WhereNotExists(sub)
+	return d
+}
+
+func (d *DbTrans) Union(sub *SubQuery) *DbTrans {
+	d.session.Union(sub)
+	return d
+}
+
+func (d *DbTrans) UnionAll(sub *SubQuery) *DbTrans {
+	d.session.UnionAll(sub)
+	return d
+}
+
+func (d *DbTrans) With(name string, sub *SubQuery) *DbTrans {
+	d.session.With(name, sub)
+	return d
+}
+
+func (d *DbTrans) WithRecursive(name string, sub *SubQuery) *DbTrans {
+	d.session.WithRecursive(name, sub)
+	return d
+}
+
+func (d *DbTrans) OrderBy(orderby ...string) *DbTrans {
+	d.session.OrderBy(orderby...)
+	return d
+}
+
+func (d *DbTrans) Limit(skip, size int) *DbTrans {
+	d.session.Limit(skip, size)
+	return d
+}
+
+func (d *DbTrans) ForUpdate() *DbTrans {
+	d.session.ForUpdate()
+	return d
+}
+
+func (d *DbTrans) ForShare() *DbTrans {
+	d.session.ForShare()
+	return d
+}
+
+func (d *DbTrans) SkipLocked() *DbTrans {
+	d.session.SkipLocked()
+	return d
+}
+
+func (d *DbTrans) NoWait() *DbTrans {
+	d.session.NoWait()
+	return d
+}
+
 func (d *DbTrans) Exec(sql string, args ...interface{}) *DbTrans {
 	d.session.Exec(sql, args...)
 	return d
 }
 
+// Query specifies raw sql query which will be executed by Get or Find in transaction
+func (d *DbTrans) Query(sql string, args ...interface{}) *DbTrans {
+	d.session.Query(sql, args...)
+	return d
+}
+
+func (d *DbTrans) QueryNamed(sql string, arg interface{}) *DbTrans {
+	d.session.QueryNamed(sql, arg)
+	return d
+}
+
+func (d *DbTrans) WhereNamed(clause string, arg interface{}) *DbTrans {
+	d.session.WhereNamed(clause, arg)
+	return d
+}
+
+// Get retrieves one record in transaction, can see uncommitted changes of the transaction
+func (d *DbTrans) Get(model interface{}) (bool, error) {
+	return d.session.getWithTx(d.tx, model)
+}
+
+// Find retrieves multiple records in transaction
+func (d *DbTrans) Find(slicePtr interface{}) error {
+	return d.session.findWithTx(d.tx, slicePtr)
+}
+
+// Exists checks if any record matches the conditions in transaction
+func (d *DbTrans) Exists(model interface{}) (bool, error) {
+	return d.session.existsWithTx(d.tx, model)
+}
+
+// Pluck selects single column into slice in transaction
+func (d *DbTrans) Pluck(col string, slicePtr interface{}) error {
+	return d.session.pluckWithTx(d.tx, col, slicePtr)
+}
+
+// FindValues scans the first column into slice of primitive type in transaction
+func (d *DbTrans) FindValues(slicePtr interface{}) error {
+	return d.session.findValuesWithTx(d.tx, slicePtr)
+}
+
+// FindMaps scans results into maps of column name to value in transaction
+func (d *DbTrans) FindMaps(maps *[]map[string]interface{}) error {
+	return d.session.findMapsWithTx(d.tx, maps)
+}
+
+// Count counts records in transaction
+func (d *DbTrans) Count(model interface{}) (int64, error) {
+	return d.session.countWithTx(d.tx, model)
+}
+
+// Scalar retrieves one value in transaction
+func (d *DbTrans) Scalar(sql string, v interface{}, args ...interface{}) error {
+	return d.session.scalarWithTx(d.tx, sql, v, args...)
+}
+
 func (d *DbTrans) Insert(model interface{}) error {
 	return d.session.insertWithTx(d.tx, model)
 }
@@ -97,3 +332,254 @@ func (d *DbTrans) Update(model interface{}) error {
 func (d *DbTrans) Delete(model interface{}) error {
 	return d.session.deleteWithTx(d.tx, model)
 }
+
+// WithTrans executes fn in db transaction on the group located by shardValue.
+// The transaction is committed if fn returns nil, rolled back if fn returns error or panics.
+// When the database reports deadlock or serialization failure, the whole fn is retried
+// with exponential backoff, see SetTransRetry, so fn must be safe to be executed more than once.
+// WithTrans always begins new transaction, use WithTransContext to join the running one.
+/*
+	Usage:
+		err := engine.WithTrans(user.Id, func(tx *shorm.DbTrans) error {
+			if err := tx.Insert(&order); err != nil {
+				return err
+			}
+			return tx.Id(user.Id).Cols("Balance").Update(&user)
+		})
+*/
+func (e *Engine) WithTrans(shardValue int64, fn func(tx *DbTrans) error) error {
+	return e.WithTransOptions(shardValue, nil, fn)
+}
+
+// WithTransOptions is WithTrans with transaction options, such as isolation level and read-only
+func (e *Engine) WithTransOptions(shardValue int64, opts *sql.TxOptions, fn func(tx *DbTrans) error) error {
+	return e.withTrans(context.Background(), shardValue, opts, fn)
+}
+
+// WithTransContext is WithTrans which joins the transaction carried by ctx, see DbTrans.Context.
+// If ctx carries running transaction of engine, fn is executed as nested transaction based on savepoint,
+// see DbTrans.WithTrans, and shardValue must be located to the same group. Otherwise new transaction is begun.
+/*
+	Usage:
+		func createOrder(ctx context.Context, order *Order) error {
+			return engine.WithTransContext(ctx, order.UserId, func(tx *shorm.DbTrans) error {
+				if err := tx.Insert(order); err != nil {
+					return err
+				}
+				// joins the transaction of createOrder as savepoint
+				return useCoupon(tx.Context(), order)
+			})
+		}
+
+		func useCoupon(ctx context.Context, order *Order) error {
+			return engine.WithTransContext(ctx, order.UserId, func(tx *shorm.DbTrans) error {
+				...
+			})
+		}
+*/
+func (e *Engine) WithTransContext(ctx context.Context, shardValue int64, fn func(tx *DbTrans) error) error {
+	if outer, ok := ctx.Value(transKey{}).(*DbTrans); ok && outer.engine == e && !outer.done {
+		group, err := locateTransGroup(outer.session.cluster, shardValue)
+		if err != nil {
+			return err
+		}
+		if group != outer.group {
+			return fmt.Errorf("nested transaction on group %s can not join transaction on group %s, use distributed transaction instead",
+				group.Name, outer.group.Name)
+		}
+		return outer.WithTrans(fn)
+	}
+	return e.withTrans(ctx, shardValue, nil, fn)
+}
+
+func (e *Engine) withTrans(ctx context.Context, shardValue int64, opts *sql.TxOptions, fn func(tx *DbTrans) error) error {
+	for retry := 0; ; retry++ {
+		err := e.execTrans(ctx, shardValue, opts, fn)
+		if err == nil || retry >= e.transRetries || !IsRetryableTransError(err) {
+			return err
+		}
+		backoff := e.transBackoff << uint(retry)
+		backoff += time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+		e.Logger.Printf("transaction failed: %v, retry %d after %v\r\n", err, retry+1, backoff)
+		time.Sleep(backoff)
+	}
+}
+
+func (e *Engine) execTrans(ctx context.Context, shardValue int64, opts *sql.TxOptions, fn func(tx *DbTrans) error) error {
+	trans, err := e.BeginTransWithOptions(shardValue, opts)
+	if err != nil {
+		return err
+	}
+	trans.ctx = context.WithValue(ctx, transKey{}, trans)
+	defer func() {
+		if p := recover(); p != nil {
+			trans.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(trans); err != nil {
+		trans.Rollback()
+		return err
+	}
+	return trans.Commit()
+}
+
+// SetTransRetry sets how many times WithTrans retries on deadlock or serialization failure,
+// and the initial backoff which is doubled on each retry.
+func (e *Engine) SetTransRetry(maxRetries int, backoff time.Duration) {
+	e.transRetries = maxRetries
+	e.transBackoff = backoff
+}
+
+// IsRetryableTransError reports whether err is deadlock or serialization failure reported by database:
+// SQL Server 1205, MySQL 1213, Postgres 40001 and 40P01.
+// Error numbers are matched per driver, 1205 of MySQL is lock wait timeout which is not retried.
+func IsRetryableTransError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case interface{ SQLErrorNumber() int32 }:
+			//SQL Server driver, error numbers of other databases do not apply
+			if e.SQLErrorNumber() == 1205 {
+				return true
+			}
+			continue
+		case interface{ SQLState() string }:
+			if state := e.SQLState(); state == "40001" || state == "40P01" {
+				return true
+			}
+		}
+		//drivers expose error code as struct field, such as mysql.MySQLError.Number and pq.Error.Code
+		value := reflect.Indirect(reflect.ValueOf(err))
+		if value.Kind() != reflect.Struct {
+			continue
+		}
+		if number := value.FieldByName("Number"); number.IsValid() {
+			switch number.Kind() {
+			case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+				if number.Int() == 1213 {
+					return true
+				}
+			case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				if number.Uint() == 1213 {
+					return true
+				}
+			}
+		}
+		if code := value.FieldByName("Code"); code.IsValid() && code.Kind() == reflect.String {
+			if s := code.String(); s == "40001" || s == "40P01" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var savepointPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (d *DbTrans) execSavepoint(name string, gen func(SavepointGenerator, string) string) error {
+	if !savepointPattern.MatchString(name) {
+		return fmt.Errorf("invalid savepoint name %q", name)
+	}
+	spGen, ok := d.session.sqlGen.(SavepointGenerator)
+	if !ok {
+		return fmt.Errorf("savepoint is not supported by driver %s", d.engine.driver)
+	}
+	sqlStr := gen(spGen, name)
+	if sqlStr == "" {
+		return nil
+	}
+	d.session.logger.Printf("sql:%s\r\n", sqlStr)
+	_, err := d.tx.Exec(sqlStr)
+	return err
+}
+
+// Savepoint creates savepoint in transaction
+func (d *DbTrans) Savepoint(name string) error {
+	return d.execSavepoint(name, SavepointGenerator.GenSavepoint)
+}
+
+// RollbackTo rolls back the changes after savepoint was created
+func (d *DbTrans) RollbackTo(name string) error {
+	return d.execSavepoint(name, SavepointGenerator.GenRollbackTo)
+}
+
+// Release releases savepoint, it is no-op on SQL Server
+func (d *DbTrans) Release(name string) error {
+	return d.execSavepoint(name, SavepointGenerator.GenReleaseSavepoint)
+}
+
+// WithTrans executes fn as nested transaction based on savepoint,
+// changes of fn are rolled back to the savepoint if fn returns error or panics,
+// the outer transaction keeps going.
+func (d *DbTrans) WithTrans(fn func(tx *DbTrans) error) (err error) {
+	d.savepoints++
+	name := fmt.Sprintf("shorm_sp_%d", d.savepoints)
+	if err = d.Savepoint(name); err != nil {
+		return err
+	}
+	commits, rollbacks := len(d.onCommit), len(d.onRollback)
+	//hooks registered by fn belong to the changes rolled back to savepoint
+	discardHooks := func() {
+		d.runHooks(d.onRollback[rollbacks:])
+		d.onCommit = d.onCommit[:commits]
+		d.onRollback = d.onRollback[:rollbacks]
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			d.RollbackTo(name)
+			discardHooks()
+			panic(p)
+		}
+	}()
+	if err = fn(d); err != nil {
+		e := d.RollbackTo(name)
+		discardHooks()
+		if e != nil {
+			return fmt.Errorf("%v, rollback to savepoint %s occurs error:%v", err, name, e)
+		}
+		return err
+	}
+	return d.Release(name)
+}
+
+// OnCommit registers fn which is called after transaction committed,
+// hooks are called in order of registration, panics of hooks are recovered and collected by HookErrors.
+/*
+	Usage:
+		tx.OnCommit(func() {
+			cache.Delete(userKey)
+		})
+*/
+func (d *DbTrans) OnCommit(fn func()) {
+	d.onCommit = append(d.onCommit, fn)
+}
+
+// OnRollback registers fn which is called after transaction rolled back or failed to commit,
+// it is not called by Rollback after transaction has been committed.
+func (d *DbTrans) OnRollback(fn func()) {
+	d.onRollback = append(d.onRollback, fn)
+}
+
+// HookErrors returns errors of panics recovered from OnCommit or OnRollback hooks,
+// the errors do not affect the result of Commit and Rollback.
+func (d *DbTrans) HookErrors() []error {
+	return d.hookErrs
+}
+
+func (d *DbTrans) runHooks(hooks []func()) {
+	for _, fn := range hooks {
+		if err := callHook(fn); err != nil {
+			d.hookErrs = append(d.hookErrs, err)
+		}
+	}
+}
+
+func callHook(fn func()) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("transaction hook panics: %v", p)
+		}
+	}()
+	fn()
+	return nil
+}
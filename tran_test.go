@@ -0,0 +1,274 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *testMySQLError) Error() string { return e.Message }
+
+type testPqError struct {
+	Code    string
+	Message string
+}
+
+func (e testPqError) Error() string { return e.Message }
+
+type testMSSqlError struct{ number int32 }
+
+func (e testMSSqlError) Error() string         { return "mssql error" }
+func (e testMSSqlError) SQLErrorNumber() int32 { return e.number }
+
+func TestIsRetryableTransError(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{errors.New("Deadlock found"), false},
+		{&testMySQLError{Number: 1213}, true},
+		{&testMySQLError{Number: 1062}, false},
+		{&testMySQLError{Number: 1205}, false},
+		{testPqError{Code: "40001"}, true},
+		{testPqError{Code: "40P01"}, true},
+		{testPqError{Code: "23505"}, false},
+		{testMSSqlError{1205}, true},
+		{testMSSqlError{2627}, false},
+		{testMSSqlError{1213}, false},
+		{fmt.Errorf("update order: %w", &testMySQLError{Number: 1213}), true},
+	}
+	for i, c := range cases {
+		if got := IsRetryableTransError(c.err); got != c.retryable {
+			t.Errorf("case %d: IsRetryableTransError(%v) = %v, expected %v", i, c.err, got, c.retryable)
+		}
+	}
+}
+
+func TestTransEndOnce(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	tx, err := engine.BeginTrans(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Rollback(); err != sql.ErrTxDone {
+		t.Errorf("Rollback() after Commit error = %v, want sql.ErrTxDone", err)
+	}
+	if err = tx.Commit(); err != sql.ErrTxDone {
+		t.Errorf("Commit() twice error = %v, want sql.ErrTxDone", err)
+	}
+	if got := db.log(); got != "begin;commit" {
+		t.Errorf("statements = %q, want begin;commit", got)
+	}
+	if n := engine.getCluster().sessions; n != 0 {
+		t.Errorf("sessions of cluster = %d, want 0", n)
+	}
+}
+
+func TestWithTransPanic(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Errorf("panic of fn is not propagated")
+			}
+		}()
+		engine.WithTrans(0, func(tx *DbTrans) error {
+			defer tx.Rollback()
+			panic("boom")
+		})
+	}()
+	if got := db.log(); got != "begin;rollback" {
+		t.Errorf("statements = %q, want begin;rollback", got)
+	}
+	if n := engine.getCluster().sessions; n != 0 {
+		t.Errorf("sessions of cluster = %d, want 0", n)
+	}
+}
+
+func TestSavepoints(t *testing.T) {
+	cases := []struct {
+		driver string
+		want   string
+	}{
+		{"mysql", "begin;savepoint sp;rollback to savepoint sp;release savepoint sp;commit"},
+		{"mssql", "begin;save transaction sp;rollback transaction sp;commit"},
+	}
+	for _, c := range cases {
+		engine, db := newFakeEngine(c.driver)
+		tx, _ := engine.BeginTrans(0)
+		if err := tx.Savepoint("sp"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.RollbackTo("sp"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Release("sp"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Savepoint("sp;drop table T_User"); err == nil {
+			t.Errorf("%s: invalid savepoint name is accepted", c.driver)
+		}
+		tx.Commit()
+		if got := db.log(); got != c.want {
+			t.Errorf("%s: statements = %q, want %q", c.driver, got, c.want)
+		}
+	}
+}
+
+//Generator without savepoint support
+type plainGenerator struct{ SqlGenerator }
+
+func TestSavepointNotSupported(t *testing.T) {
+	engine, _ := newFakeEngine("mysql")
+	tx, _ := engine.BeginTrans(0)
+	defer tx.Rollback()
+	tx.session.sqlGen = plainGenerator{tx.session.sqlGen}
+	if err := tx.Savepoint("sp"); err == nil {
+		t.Errorf("Savepoint() succeeds with generator not supporting savepoints")
+	}
+}
+
+func TestNestedWithTrans(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	errNested := errors.New("nested")
+	err := engine.WithTransContext(context.Background(), 0, func(tx *DbTrans) error {
+		if err := tx.WithTrans(func(tx *DbTrans) error { return errNested }); err != errNested {
+			t.Errorf("nested WithTrans error = %v, want errNested", err)
+		}
+		return engine.WithTransContext(tx.Context(), 0, func(tx *DbTrans) error { return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "begin;savepoint shorm_sp_1;rollback to savepoint shorm_sp_1;" +
+		"savepoint shorm_sp_2;release savepoint shorm_sp_2;commit"
+	if got := db.log(); got != want {
+		t.Errorf("statements = %q, want %q", got, want)
+	}
+}
+
+func TestNestedWithTransOtherGroup(t *testing.T) {
+	engine, dbs := newFakeGroupsEngine("mysql", 2)
+	err := engine.WithTransContext(context.Background(), 0, func(tx *DbTrans) error {
+		return engine.WithTransContext(tx.Context(), 1, func(tx *DbTrans) error { return nil })
+	})
+	if err == nil {
+		t.Errorf("nested transaction on other group is accepted")
+	}
+	if got := dbs[0].log(); got != "begin;rollback" {
+		t.Errorf("statements = %q, want begin;rollback", got)
+	}
+	if got := dbs[1].log(); got != "" {
+		t.Errorf("other group is touched: %s", got)
+	}
+}
+
+func TestTransHooks(t *testing.T) {
+	engine, _ := newFakeEngine("mysql")
+	var calls []string
+	hook := func(name string) func() {
+		return func() { calls = append(calls, name) }
+	}
+	err := engine.WithTrans(0, func(tx *DbTrans) error {
+		tx.OnCommit(hook("commit1"))
+		tx.OnRollback(hook("rollback"))
+		tx.OnCommit(func() { panic("boom") })
+		tx.OnCommit(hook("commit2"))
+		//hooks of the changes rolled back to savepoint are discarded
+		tx.WithTrans(func(tx *DbTrans) error {
+			tx.OnCommit(hook("nested commit"))
+			tx.OnRollback(hook("nested rollback"))
+			return errors.New("nested")
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(calls); got != "[nested rollback commit1 commit2]" {
+		t.Errorf("hooks called = %s", got)
+	}
+
+	calls = nil
+	tx, _ := engine.BeginTrans(0)
+	tx.OnCommit(hook("commit"))
+	tx.OnRollback(hook("rollback"))
+	tx.Commit()
+	tx.Rollback()
+	if got := fmt.Sprint(calls); got != "[commit]" {
+		t.Errorf("hooks called by Rollback after Commit = %s", got)
+	}
+	if len(tx.HookErrors()) != 0 {
+		t.Errorf("HookErrors() = %v, want empty", tx.HookErrors())
+	}
+
+	calls = nil
+	tx, _ = engine.BeginTrans(0)
+	tx.OnCommit(hook("commit"))
+	tx.OnRollback(func() { panic("boom") })
+	tx.OnRollback(hook("rollback"))
+	tx.Rollback()
+	if got := fmt.Sprint(calls); got != "[rollback]" {
+		t.Errorf("hooks called by Rollback = %s", got)
+	}
+	if len(tx.HookErrors()) != 1 {
+		t.Errorf("HookErrors() = %v, want the panic of hook", tx.HookErrors())
+	}
+}
+
+func TestRowLockOutsideTrans(t *testing.T) {
+	engine, db := newFakeEngine("mysql")
+	for name, query := range map[string]func(s *Session) error{
+		"Exists": func(s *Session) error { _, err := s.Exists(&genUser{}); return err },
+		"Count":  func(s *Session) error { _, err := s.Count(&genUser{}); return err },
+		"FindValues": func(s *Session) error {
+			var ids []int64
+			return s.Query("select UserId from T_User").FindValues(&ids)
+		},
+		"FindMaps": func(s *Session) error {
+			var maps []map[string]interface{}
+			return s.Table("T_User").FindMaps(&maps)
+		},
+		"FindInBatches": func(s *Session) error {
+			var users []*genUser
+			return s.FindInBatches(&users, 10, func(interface{}) error { return nil })
+		},
+	} {
+		s := engine.StartSession()
+		if err := query(s.ForUpdate()); err == nil {
+			t.Errorf("%s() with row lock outside transaction succeeded", name)
+		}
+		engine.EndSession(s)
+	}
+	if db.log() != "" {
+		t.Errorf("queries are executed: %s", db.log())
+	}
+
+	tx, _ := engine.BeginTrans(0)
+	defer tx.Rollback()
+	if _, err := tx.ForUpdate().Exists(&genUser{}); err != nil {
+		t.Errorf("Exists() with row lock in transaction error = %v", err)
+	}
+	if !strings.Contains(db.log(), "for update") {
+		t.Errorf("row lock is not rendered: %s", db.log())
+	}
+	if _, err := tx.ForUpdate().Count(&genUser{}); err == nil {
+		t.Errorf("Count() with row lock in transaction succeeded, but count sql does not lock")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//Validation of cluster configuration
+
+package shorm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// ConfigProblem describes one problem found in cluster configuration
+type ConfigProblem struct {
+	Group   string //Name of the group, empty if problem is on cluster level
+	Node    string //Name of the node, empty if problem is on group level
+	Message string
+}
+
+func (p ConfigProblem) String() string {
+	switch {
+	case p.Node != "":
+		return fmt.Sprintf("group %q, node %q: %s", p.Group, p.Node, p.Message)
+	case p.Group != "":
+		return fmt.Sprintf("group %q: %s", p.Group, p.Message)
+	default:
+		return "cluster: " + p.Message
+	}
+}
+
+// ConfigError is the list of problems found by Cluster.Validate
+type ConfigError []ConfigProblem
+
+func (e ConfigError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("invalid cluster configuration, %d problem(s):", len(e)))
+	for _, p := range e {
+		buf.WriteString("\n\t")
+		buf.WriteString(p.String())
+	}
+	return buf.String()
+}
+
+func (e *ConfigError) add(group, node, format string, args ...interface{}) {
+	*e = append(*e, ConfigProblem{Group: group, Node: node, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the cluster configuration for inconsistencies, returns ConfigError which lists all problems,
+// nil if the cluster is valid. Names, default group and full coverage of ranges are optional,
+// shard values out of all ranges are routed to the default group at runtime.
+/*
+	Checks:
+		- at least one group, each group has nodes and exactly one master
+		- names of groups and nodes are unique if specified
+		- ranges of groups are in [0,TotalGroups) without overlap
+		- at most one default group
+*/
+func (c *Cluster) Validate() error {
+	var problems ConfigError
+	if len(c.Groups) <= 0 {
+		problems.add("", "", "no db group defined")
+		return problems
+	}
+	groupNames := make(map[string]bool)
+	nodeNames := make(map[string]string)
+	defaults := 0
+	for i, g := range c.Groups {
+		if g == nil {
+			problems.add("", "", "group #%d is empty", i)
+			continue
+		}
+		if g.Name != "" && groupNames[g.Name] {
+			problems.add(g.Name, "", "duplicated group name")
+		}
+		groupNames[g.Name] = true
+		if g.IsDefault {
+			defaults++
+		}
+		problems = append(problems, g.validate(nodeNames)...)
+	}
+	if len(c.Groups) <= 1 {
+		return problems.orNil()
+	}
+
+	if defaults > 1 {
+		problems.add("", "", "%d groups are marked as default, only one is allowed", defaults)
+	}
+	if c.TotalGroups <= 0 {
+		problems.add("", "", "total_groups must be greater than 0, but %d", c.TotalGroups)
+		return problems.orNil()
+	}
+	ranges := make([]*DbGroup, 0, len(c.Groups))
+	for _, g := range c.Groups {
+		if g == nil {
+			continue
+		}
+		if g.RangeFrom < 0 || g.RangeFrom >= g.RangeTo {
+			problems.add(g.Name, "", "invalid range [%d,%d)", g.RangeFrom, g.RangeTo)
+			continue
+		}
+		if g.RangeTo > int64(c.TotalGroups) {
+			problems.add(g.Name, "", "range [%d,%d) exceeds total_groups %d", g.RangeFrom, g.RangeTo, c.TotalGroups)
+		}
+		ranges = append(ranges, g)
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].RangeFrom < ranges[j].RangeFrom })
+	var next int64
+	var prev *DbGroup
+	for _, g := range ranges {
+		if g.RangeFrom < next {
+			problems.add(g.Name, "", "range [%d,%d) overlaps with group %q [%d,%d)",
+				g.RangeFrom, g.RangeTo, prev.Name, prev.RangeFrom, prev.RangeTo)
+		}
+		if g.RangeTo > next {
+			next = g.RangeTo
+			prev = g
+		}
+	}
+	return problems.orNil()
+}
+
+func (e ConfigError) orNil() error {
+	if len(e) <= 0 {
+		return nil
+	}
+	return e
+}
+
+func (d *DbGroup) validate(nodeNames map[string]string) ConfigError {
+	var problems ConfigError
+	if len(d.Nodes) <= 0 {
+		problems.add(d.Name, "", "no node defined")
+		return problems
+	}
+	masters := 0
+	for i, n := range d.Nodes {
+		if n == nil {
+			problems.add(d.Name, "", "node #%d is empty", i)
+			continue
+		}
+		if group, ok := nodeNames[n.Name]; ok && n.Name != "" {
+			problems.add(d.Name, n.Name, "duplicated node name, already defined in group %q", group)
+		} else if n.Name != "" {
+			nodeNames[n.Name] = d.Name
+		}
+		if n.ConnStr == "" {
+			problems.add(d.Name, n.Name, "empty connection string")
+		}
+		switch n.Type {
+		case NodeType_Master:
+			masters++
+		case NodeType_Slave, "":
+		default:
+			problems.add(d.Name, n.Name, "unknown node_type %q, must be master or slave", n.Type)
+		}
+	}
+	if len(d.Nodes) > 1 && masters <= 0 {
+		problems.add(d.Name, "", "no master node")
+	} else if masters > 1 {
+		problems.add(d.Name, "", "%d master nodes, only one is allowed", masters)
+	}
+	return problems
+}
+
+// ValidateConfig loads the config file and validates driver and cluster,
+// see NewEngineFromConfig for the file format.
+func ValidateConfig(config string) error {
+	cfg, err := loadClusterConfig(config)
+	if err != nil {
+		return err
+	}
+	err = cfg.Cluster.Validate()
+	if _, ok := sqlGenDict[cfg.Driver]; !ok {
+		problems, _ := err.(ConfigError)
+		problems = append(ConfigError{{Message: fmt.Sprintf("driver %q is not supported", cfg.Driver)}}, problems...)
+		return problems
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 The shorm Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shorm
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestGroup(name string, from, to int64, isDefault bool) *DbGroup {
+	return &DbGroup{
+		Name:      name,
+		RangeFrom: from,
+		RangeTo:   to,
+		IsDefault: isDefault,
+		Nodes: []*DbNode{
+			{Name: name + "_master", ConnStr: "conn", Type: NodeType_Master},
+			{Name: name + "_slave", ConnStr: "conn", Type: NodeType_Slave},
+		},
+	}
+}
+
+func TestValidateCluster(t *testing.T) {
+	cases := []struct {
+		name     string
+		cluster  *Cluster
+		problems []string
+	}{
+		{
+			name: "valid",
+			cluster: &Cluster{TotalGroups: 5, Groups: []*DbGroup{
+				newTestGroup("g1", 0, 3, true), newTestGroup("g2", 3, 5, false),
+			}},
+		},
+		{
+			name:     "single group without range",
+			cluster:  &Cluster{TotalGroups: 1, Groups: []*DbGroup{{Nodes: []*DbNode{{Name: "master", ConnStr: "conn"}}}}},
+			problems: nil,
+		},
+		{
+			name:     "no group",
+			cluster:  &Cluster{TotalGroups: 1},
+			problems: []string{"no db group"},
+		},
+		{
+			name: "overlap",
+			cluster: &Cluster{TotalGroups: 10, Groups: []*DbGroup{
+				newTestGroup("g1", 0, 4, true), newTestGroup("g2", 3, 6, false), newTestGroup("g3", 7, 10, false),
+			}},
+			problems: []string{`overlaps with group "g1"`},
+		},
+		{
+			name: "range exceeds total groups",
+			cluster: &Cluster{TotalGroups: 3, Groups: []*DbGroup{
+				newTestGroup("g1", 0, 3, true), newTestGroup("g2", 3, 5, false),
+			}},
+			problems: []string{"exceeds total_groups 3"},
+		},
+		{
+			name: "default groups",
+			cluster: &Cluster{TotalGroups: 4, Groups: []*DbGroup{
+				newTestGroup("g1", 0, 2, true), newTestGroup("g2", 2, 4, true),
+			}},
+			problems: []string{"2 groups are marked as default"},
+		},
+		{
+			name: "without names and default group",
+			cluster: &Cluster{TotalGroups: 4, Groups: []*DbGroup{
+				{RangeFrom: 0, RangeTo: 2, Nodes: []*DbNode{{ConnStr: "conn"}}},
+				{RangeFrom: 2, RangeTo: 4, Nodes: []*DbNode{{ConnStr: "conn", Type: NodeType_Master}, {ConnStr: "conn", Type: NodeType_Slave}}},
+			}},
+		},
+		{
+			name: "duplicated names",
+			cluster: &Cluster{TotalGroups: 4, Groups: []*DbGroup{
+				newTestGroup("g1", 0, 2, true), newTestGroup("g1", 2, 4, false),
+			}},
+			problems: []string{"duplicated group name", `node "g1_master": duplicated node name`, `node "g1_slave": duplicated node name`},
+		},
+		{
+			name: "no master",
+			cluster: &Cluster{TotalGroups: 1, Groups: []*DbGroup{{Name: "g1", Nodes: []*DbNode{
+				{Name: "n1", ConnStr: "conn", Type: NodeType_Slave},
+				{Name: "n2", ConnStr: "conn", Type: NodeType_Slave},
+			}}}},
+			problems: []string{"no master node"},
+		},
+	}
+	for _, c := range cases {
+		err := c.cluster.Validate()
+		if len(c.problems) <= 0 {
+			if err != nil {
+				t.Errorf("%s: expected valid, but %v", c.name, err)
+			}
+			continue
+		}
+		problems, ok := err.(ConfigError)
+		if !ok {
+			t.Errorf("%s: expected ConfigError, but %#v", c.name, err)
+			continue
+		}
+		if len(problems) != len(c.problems) {
+			t.Errorf("%s: expected %d problems, but %v", c.name, len(c.problems), err)
+		}
+		for _, expected := range c.problems {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: expected problem %q, but %v", c.name, expected, err)
+			}
+		}
+	}
+}